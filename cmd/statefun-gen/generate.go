@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"statefun-sdk-go/pkg/statefun"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	statefunImportPath = "statefun-sdk-go/pkg/statefun"
+
+	functionDirective = "//statefun:function"
+	handlerDirective  = "//statefun:handler"
+)
+
+// The Go types of the built-in primitive types, used to
+// generate typed accessors for states without a go option.
+var primitiveGoTypes = map[string]string{
+	"BoolType":     "bool",
+	"Int32Type":    "int32",
+	"Int64Type":    "int64",
+	"Float32Type":  "float32",
+	"Float64Type":  "float64",
+	"StringType":   "string",
+	"BytesType":    "[]byte",
+	"Uint32Type":   "uint32",
+	"Uint64Type":   "uint64",
+	"TimeType":     "time.Time",
+	"DurationType": "time.Duration",
+}
+
+type function struct {
+	Name     string
+	Receiver string
+	TypeName string
+	Invoke   string
+	States   []state
+	Handlers []handler
+}
+
+type state struct {
+	Field      string
+	Name       string
+	ValueType  string
+	GoType     string
+	Expiration string
+	IsValue    bool
+
+	// The statefun.Value used to access the state.
+	Accessor string
+}
+
+type handler struct {
+	Method    string
+	ValueType string
+}
+
+type generatedFile struct {
+	Package   string
+	Statefun  string
+	Imports   []string
+	Functions []function
+}
+
+// Parses the Go files of the package in dir and returns the source
+// of the generated file, or nil if the package has no annotated
+// functions.
+func generate(dir string, output string) ([]byte, error) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != output
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(packages) > 1 {
+		return nil, fmt.Errorf("%s contains more than one package", dir)
+	}
+
+	for name, pkg := range packages {
+		g := &generator{
+			fset:    fset,
+			file:    generatedFile{Package: name, Statefun: "statefun"},
+			imports: map[string]string{},
+			methods: map[string]map[string]*ast.FuncDecl{},
+		}
+
+		files := make([]string, 0, len(pkg.Files))
+		for path := range pkg.Files {
+			files = append(files, path)
+		}
+		sort.Strings(files)
+
+		for _, path := range files {
+			g.collectMethods(pkg.Files[path])
+		}
+
+		for _, path := range files {
+			if err := g.parseFile(pkg.Files[path]); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(g.file.Functions) == 0 {
+			return nil, nil
+		}
+
+		return g.render()
+	}
+
+	return nil, nil
+}
+
+type generator struct {
+	fset    *token.FileSet
+	file    generatedFile
+	imports map[string]string
+	methods map[string]map[string]*ast.FuncDecl
+}
+
+func (g *generator) collectMethods(file *ast.File) {
+	for _, decl := range file.Decls {
+		method, ok := decl.(*ast.FuncDecl)
+		if !ok || method.Recv == nil || len(method.Recv.List) != 1 {
+			continue
+		}
+
+		receiver := method.Recv.List[0].Type
+		if star, ok := receiver.(*ast.StarExpr); ok {
+			receiver = star.X
+		}
+
+		if ident, ok := receiver.(*ast.Ident); ok {
+			if g.methods[ident.Name] == nil {
+				g.methods[ident.Name] = map[string]*ast.FuncDecl{}
+			}
+			g.methods[ident.Name][method.Name.Name] = method
+		}
+	}
+}
+
+func (g *generator) parseFile(file *ast.File) error {
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+
+		imports[name] = path
+		if path == statefunImportPath {
+			g.file.Statefun = name
+		}
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			doc := typeSpec.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+
+			typeName, ok := directive(doc, functionDirective)
+			if !ok {
+				continue
+			}
+
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				return g.errorf(typeSpec.Pos(), "%s must be a struct to be a stateful function", typeSpec.Name.Name)
+			}
+
+			fn, err := g.parseFunction(typeSpec.Name.Name, typeName, structType, imports)
+			if err != nil {
+				return err
+			}
+
+			g.file.Functions = append(g.file.Functions, fn)
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) parseFunction(name string, typeName string, structType *ast.StructType, imports map[string]string) (function, error) {
+	fn := function{Name: name, Receiver: strings.ToLower(name[:1]), TypeName: typeName}
+	if _, err := statefun.ParseTypeName(typeName); err != nil {
+		return fn, g.errorf(structType.Pos(), "invalid function type of %s: %v", name, err)
+	}
+
+	names := map[string]bool{}
+	for _, field := range structType.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+
+		tag, _ := strconv.Unquote(field.Tag.Value)
+		value, ok := reflect.StructTag(tag).Lookup("statefun")
+		if !ok {
+			continue
+		}
+
+		if len(field.Names) != 1 {
+			return fn, g.errorf(field.Pos(), "tagged ValueSpec fields of %s must be declared one per line", name)
+		}
+
+		s, err := g.parseState(field, value, imports)
+		if err != nil {
+			return fn, err
+		}
+
+		if names[s.Name] {
+			return fn, g.errorf(field.Pos(), "%s has more than one state named %s", name, s.Name)
+		}
+		names[s.Name] = true
+
+		for _, accessor := range []string{"Get", "Set", "Remove"} {
+			if _, exists := g.methods[name][accessor+s.Field]; exists {
+				return fn, g.errorf(field.Pos(), "%s already has a method %s%s", name, accessor, s.Field)
+			}
+		}
+
+		if s.IsValue {
+			s.Accessor = fmt.Sprintf("%s.%s", fn.Receiver, s.Field)
+		} else {
+			s.Accessor = fmt.Sprintf("%s.Value[%s]{ValueSpec: %s.%s}", g.file.Statefun, s.GoType, fn.Receiver, s.Field)
+		}
+
+		fn.States = append(fn.States, s)
+	}
+
+	if _, exists := g.methods[name]["Spec"]; exists {
+		return fn, g.errorf(structType.Pos(), "%s already has a method Spec", name)
+	}
+
+	methods := make([]string, 0, len(g.methods[name]))
+	for method := range g.methods[name] {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		decl := g.methods[name][method]
+		if method == "Invoke" {
+			fn.Invoke = fn.Receiver
+			if _, ok := decl.Recv.List[0].Type.(*ast.StarExpr); ok {
+				fn.Invoke = "&" + fn.Receiver
+			}
+			continue
+		}
+
+		valueType, ok := directive(decl.Doc, handlerDirective)
+		if !ok {
+			continue
+		}
+
+		if decl.Type.Params.NumFields() != 2 || decl.Type.Results.NumFields() != 1 {
+			return fn, g.errorf(decl.Pos(), "handler %s.%s must be of the form func(statefun.Context, T) error", name, method)
+		}
+
+		if err := g.useImports(valueType, imports); err != nil {
+			return fn, g.errorf(decl.Pos(), "invalid handler type of %s.%s: %v", name, method, err)
+		}
+
+		fn.Handlers = append(fn.Handlers, handler{Method: method, ValueType: valueType})
+	}
+
+	if fn.Invoke != "" && len(fn.Handlers) > 0 {
+		return fn, g.errorf(structType.Pos(), "%s cannot have both an Invoke method and handler methods", name)
+	}
+
+	if fn.Invoke == "" && len(fn.Handlers) == 0 {
+		return fn, g.errorf(structType.Pos(), "%s must have an Invoke method or handler methods", name)
+	}
+
+	return fn, nil
+}
+
+// Parses a field tag of the form:
+//
+//	statefun:"<name>,type=<SimpleType>[,go=<Go type>][,expireAfterCall=<duration>|expireAfterWrite=<duration>]"
+func (g *generator) parseState(field *ast.Field, tag string, imports map[string]string) (state, error) {
+	s := state{Field: field.Names[0].Name}
+
+	switch fieldType := field.Type.(type) {
+	case *ast.SelectorExpr:
+		if !g.isStatefun(fieldType.X, imports) || fieldType.Sel.Name != "ValueSpec" {
+			return s, g.errorf(field.Pos(), "tagged field %s must be a statefun.ValueSpec or statefun.Value", s.Field)
+		}
+	case *ast.IndexExpr:
+		selector, ok := fieldType.X.(*ast.SelectorExpr)
+		if !ok || !g.isStatefun(selector.X, imports) || selector.Sel.Name != "Value" {
+			return s, g.errorf(field.Pos(), "tagged field %s must be a statefun.ValueSpec or statefun.Value", s.Field)
+		}
+
+		s.IsValue = true
+		s.GoType = g.source(fieldType.Index)
+	default:
+		return s, g.errorf(field.Pos(), "tagged field %s must be a statefun.ValueSpec or statefun.Value", s.Field)
+	}
+
+	parts := strings.Split(tag, ",")
+	s.Name = strings.TrimSpace(parts[0])
+	if s.Name == "" {
+		return s, g.errorf(field.Pos(), "tagged field %s is missing a state name", s.Field)
+	}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			return s, g.errorf(field.Pos(), "invalid option %q of field %s", part, s.Field)
+		}
+
+		switch key {
+		case "type":
+			s.ValueType = value
+		case "go":
+			s.GoType = value
+		case "expireAfterCall", "expireAfterWrite":
+			if s.Expiration != "" {
+				return s, g.errorf(field.Pos(), "field %s may only have one expiration", s.Field)
+			}
+
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return s, g.errorf(field.Pos(), "invalid expiration of field %s: %v", s.Field, err)
+			}
+
+			expiration := "ExpireAfterCall"
+			if key == "expireAfterWrite" {
+				expiration = "ExpireAfterWrite"
+			}
+			s.Expiration = fmt.Sprintf("%s.%s(%s)", g.file.Statefun, expiration, durationSource(duration))
+			g.imports["time"] = "time"
+		default:
+			return s, g.errorf(field.Pos(), "unknown option %q of field %s", key, s.Field)
+		}
+	}
+
+	if s.ValueType == "" {
+		return s, g.errorf(field.Pos(), "tagged field %s is missing a type option", s.Field)
+	}
+
+	if s.GoType == "" {
+		if selector, ok := strings.CutPrefix(s.ValueType, g.file.Statefun+"."); ok {
+			s.GoType = primitiveGoTypes[selector]
+
+			// the inferred type may need an import the source lacks
+			if strings.HasPrefix(s.GoType, "time.") {
+				g.imports["time"] = "time"
+			}
+		}
+	}
+
+	if s.GoType == "" {
+		return s, g.errorf(field.Pos(), "cannot infer the Go type of field %s, please add a go option", s.Field)
+	}
+
+	for _, expr := range []string{s.ValueType, s.GoType} {
+		if err := g.useImports(expr, imports); err != nil {
+			return s, g.errorf(field.Pos(), "invalid option of field %s: %v", s.Field, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (g *generator) isStatefun(expr ast.Expr, imports map[string]string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && imports[ident.Name] == statefunImportPath
+}
+
+// Records the imports referenced by a Go expression, so they
+// can be added to the generated file.
+func (g *generator) useImports(source string, imports map[string]string) error {
+	expr, err := parser.ParseExpr(source)
+	if err != nil {
+		return err
+	}
+
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok {
+				if path, exists := imports[ident.Name]; exists {
+					g.imports[ident.Name] = path
+				}
+			}
+		}
+		return true
+	})
+
+	return nil
+}
+
+func (g *generator) source(node ast.Node) string {
+	buffer := bytes.Buffer{}
+	_ = format.Node(&buffer, g.fset, node)
+	return buffer.String()
+}
+
+func (g *generator) errorf(pos token.Pos, format string, args ...interface{}) error {
+	position := g.fset.Position(pos)
+	return fmt.Errorf("%s:%d: %s", filepath.Base(position.Filename), position.Line, fmt.Sprintf(format, args...))
+}
+
+func (g *generator) render() ([]byte, error) {
+	g.imports[g.file.Statefun] = statefunImportPath
+	for name, path := range g.imports {
+		if name == path[strings.LastIndex(path, "/")+1:] {
+			g.file.Imports = append(g.file.Imports, strconv.Quote(path))
+		} else {
+			g.file.Imports = append(g.file.Imports, name+" "+strconv.Quote(path))
+		}
+	}
+	sort.Strings(g.file.Imports)
+
+	buffer := bytes.Buffer{}
+	if err := fileTemplate.Execute(&buffer, g.file); err != nil {
+		return nil, err
+	}
+
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+
+	return source, nil
+}
+
+// Returns the most readable Go expression for the duration.
+func durationSource(d time.Duration) string {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	}
+
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d * %s", d/u.unit, u.name)
+		}
+	}
+
+	return fmt.Sprintf("time.Duration(%d)", int64(d))
+}
+
+// Returns the argument of the directive in the comment group.
+func directive(doc *ast.CommentGroup, name string) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+
+	for _, comment := range doc.List {
+		if argument, ok := strings.CutPrefix(comment.Text, name+" "); ok {
+			return strings.TrimSpace(argument), true
+		}
+	}
+
+	return "", false
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by statefun-gen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+{{- range .Imports }}
+	{{ . }}
+{{- end }}
+)
+{{ $sf := .Statefun }}
+{{- range .Functions }}
+{{- $fn := . }}
+{{- $r := .Receiver }}
+// {{ .Name }}FunctionType is the TypeName of the {{ .Name }} function.
+var {{ .Name }}FunctionType = {{ $sf }}.TypeNameFrom({{ printf "%q" .TypeName }})
+
+// Creates a new {{ .Name }} with all of its states initialized.
+func New{{ .Name }}() {{ .Name }} {
+	return {{ .Name }}{
+	{{- range .States }}
+		{{- if .IsValue }}
+		{{ .Field }}: {{ $sf }}.Value[{{ .GoType }}]{ValueSpec: {{ $sf }}.ValueSpec{
+		{{- else }}
+		{{ .Field }}: {{ $sf }}.ValueSpec{
+		{{- end }}
+			Name:      {{ printf "%q" .Name }},
+			ValueType: {{ .ValueType }},
+			{{- if .Expiration }}
+			Expiration: {{ .Expiration }},
+			{{- end }}
+		}{{ if .IsValue }}}{{ end }},
+	{{- end }}
+	}
+}
+
+// Returns the StatefulFunctionSpec of {{ .Name }}, with all of its states registered.
+func ({{ $r }} {{ .Name }}) Spec() {{ $sf }}.StatefulFunctionSpec {
+	return {{ $sf }}.StatefulFunctionSpec{
+		FunctionType: {{ .Name }}FunctionType,
+		States: []{{ $sf }}.ValueSpec{
+		{{- range .States }}
+			{{ $r }}.{{ .Field }}{{ if .IsValue }}.ValueSpec{{ end }},
+		{{- end }}
+		},
+		{{- if .Invoke }}
+		Function: {{ .Invoke }},
+		{{- else }}
+		Function: {{ $sf }}.Router()
+		{{- range .Handlers }}.
+			On({{ .ValueType }}, {{ $r }}.{{ .Method }})
+		{{- end }},
+		{{- end }}
+	}
+}
+{{ range .States }}
+// Gets the {{ .Name }} state, returning false if it has no value.
+func ({{ $r }} {{ $fn.Name }}) Get{{ .Field }}(ctx {{ $sf }}.Context) ({{ .GoType }}, bool) {
+	return {{ .Accessor }}.Get(ctx)
+}
+
+// Sets the {{ .Name }} state.
+func ({{ $r }} {{ $fn.Name }}) Set{{ .Field }}(ctx {{ $sf }}.Context, value {{ .GoType }}) {
+	{{ .Accessor }}.Set(ctx, value)
+}
+
+// Removes the {{ .Name }} state.
+func ({{ $r }} {{ $fn.Name }}) Remove{{ .Field }}(ctx {{ $sf }}.Context) {
+	{{ .Accessor }}.Remove(ctx)
+}
+{{ end }}
+{{- end }}
+`))
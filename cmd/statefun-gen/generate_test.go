@@ -0,0 +1,179 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePackage(t *testing.T, source string) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "functions.go"), []byte(source), 0644))
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writePackage(t, `package functions
+
+import (
+	sf "statefun-sdk-go/pkg/statefun"
+	"example.com/orders/pb"
+)
+
+var OrderType = sf.MakeProtobufType(&pb.Order{})
+
+//statefun:function com.example/orders
+type Orders struct {
+	Count  sf.ValueSpec        `+"`"+`statefun:"count,type=sf.Int64Type,expireAfterWrite=36h"`+"`"+`
+	Latest sf.Value[*pb.Order] `+"`"+`statefun:"latest,type=OrderType"`+"`"+`
+	Cache  map[string]string
+}
+
+//statefun:handler OrderType
+func (o Orders) OnOrder(ctx sf.Context, order *pb.Order) error {
+	return nil
+}
+
+//statefun:handler sf.StringType
+func (o Orders) OnCommand(ctx sf.Context, command string) error {
+	return nil
+}
+`)
+
+	source, err := generate(dir, "statefun_gen.go")
+	assert.NoError(t, err)
+
+	generated := string(source)
+	assert.Contains(t, generated, "// Code generated by statefun-gen. DO NOT EDIT.")
+	assert.Contains(t, generated, `sf "statefun-sdk-go/pkg/statefun"`)
+	assert.Contains(t, generated, `"example.com/orders/pb"`)
+	assert.Contains(t, generated, `"time"`)
+	assert.Contains(t, generated, `var OrdersFunctionType = sf.TypeNameFrom("com.example/orders")`)
+	assert.Contains(t, generated, "Expiration: sf.ExpireAfterWrite(36 * time.Hour),")
+	assert.Contains(t, generated, "Latest: sf.Value[*pb.Order]{ValueSpec: sf.ValueSpec{")
+	assert.Contains(t, generated, "\t\t\to.Count,\n\t\t\to.Latest.ValueSpec,\n")
+	assert.Contains(t, generated, "Function: sf.Router().\n\t\t\tOn(sf.StringType, o.OnCommand).\n\t\t\tOn(OrderType, o.OnOrder),")
+	assert.Contains(t, generated, "func (o Orders) GetCount(ctx sf.Context) (int64, bool) {\n\treturn sf.Value[int64]{ValueSpec: o.Count}.Get(ctx)")
+	assert.Contains(t, generated, "func (o Orders) SetLatest(ctx sf.Context, value *pb.Order) {\n\to.Latest.Set(ctx, value)")
+	assert.NotContains(t, generated, "Cache")
+}
+
+func TestGenerateInferredTimeTypes(t *testing.T) {
+	// the package itself does not import time
+	dir := writePackage(t, `package functions
+
+import "statefun-sdk-go/pkg/statefun"
+
+//statefun:function com.example/session
+type Session struct {
+	Last    statefun.ValueSpec `+"`"+`statefun:"last,type=statefun.TimeType"`+"`"+`
+	Elapsed statefun.ValueSpec `+"`"+`statefun:"elapsed,type=statefun.DurationType"`+"`"+`
+}
+
+func (s Session) Invoke(ctx statefun.Context, msg statefun.Message) error {
+	return nil
+}
+`)
+
+	source, err := generate(dir, "statefun_gen.go")
+	assert.NoError(t, err)
+
+	generated := string(source)
+	assert.Contains(t, generated, `"time"`)
+	assert.Contains(t, generated, "func (s Session) GetLast(ctx statefun.Context) (time.Time, bool) {")
+	assert.Contains(t, generated, "func (s Session) SetElapsed(ctx statefun.Context, value time.Duration) {")
+
+	// the generated file must type check alongside the package
+	assert.NoError(t, typeCheck(string(source), dir))
+}
+
+// Type checks the generated source together with the package in dir,
+// importing statefun-sdk-go from source. The files are checked as if
+// they were in this directory, so that imports resolve within the module.
+func typeCheck(generated string, dir string) error {
+	fset := token.NewFileSet()
+	sources := map[string]string{"statefun_gen.go": generated}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		sources[entry.Name()] = string(data)
+	}
+
+	files := make([]*ast.File, 0, len(sources))
+	for name, source := range sources {
+		file, err := parser.ParseFile(fset, name, source, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = config.Check("functions", fset, files, nil)
+	return err
+}
+
+func TestGenerateWithoutFunctions(t *testing.T) {
+	dir := writePackage(t, "package functions\n\ntype Plain struct{}\n")
+
+	source, err := generate(dir, "statefun_gen.go")
+	assert.NoError(t, err)
+	assert.Nil(t, source)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	cases := map[string]string{
+		"is missing a type option": `
+//statefun:function com.example/f
+type F struct {
+	Seen statefun.ValueSpec ` + "`" + `statefun:"seen"` + "`" + `
+}
+func (f F) Invoke(ctx statefun.Context, msg statefun.Message) error { return nil }`,
+
+		"cannot infer the Go type": `
+//statefun:function com.example/f
+type F struct {
+	Seen statefun.ValueSpec ` + "`" + `statefun:"seen,type=CustomType"` + "`" + `
+}
+func (f F) Invoke(ctx statefun.Context, msg statefun.Message) error { return nil }`,
+
+		"more than one state named seen": `
+//statefun:function com.example/f
+type F struct {
+	A statefun.ValueSpec ` + "`" + `statefun:"seen,type=statefun.Int32Type"` + "`" + `
+	B statefun.ValueSpec ` + "`" + `statefun:"seen,type=statefun.Int32Type"` + "`" + `
+}
+func (f F) Invoke(ctx statefun.Context, msg statefun.Message) error { return nil }`,
+
+		"must have an Invoke method or handler methods": `
+//statefun:function com.example/f
+type F struct{}`,
+
+		"invalid function type": `
+//statefun:function f
+type F struct{}`,
+	}
+
+	for message, source := range cases {
+		dir := writePackage(t, "package functions\n\nimport \"statefun-sdk-go/pkg/statefun\"\n"+source+"\n")
+
+		_, err := generate(dir, "statefun_gen.go")
+		if assert.Error(t, err, message) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Command statefun-gen generates the StatefulFunctionSpec registration
+// of stateful functions declared as annotated Go structs, so that no
+// ValueSpec is ever left out of a function's States.
+//
+// A function is a struct with a statefun:function directive naming
+// its function type, whose persisted values are ValueSpec or Value
+// fields with a statefun tag:
+//
+//	//statefun:function example/person
+//	type Person struct {
+//		Visits statefun.ValueSpec `statefun:"visits,type=statefun.Int32Type,expireAfterCall=24h"`
+//		Name   statefun.Value[string] `statefun:"name,type=statefun.StringType"`
+//	}
+//
+// The tag holds the state name followed by the options:
+//
+//	type              the SimpleType of the value (required)
+//	go                the Go type of the value, inferred for built-in types
+//	expireAfterCall   the duration after the last call the value expires
+//	expireAfterWrite  the duration after the last write the value expires
+//
+// The struct either implements StatefulFunction through an Invoke
+// method, or declares handler methods for each type of message it
+// receives, which are dispatched by a MessageRouter:
+//
+//	//statefun:handler GreetRequestType
+//	func (p Person) OnGreetRequest(ctx statefun.Context, request GreetRequest) error
+//
+// For each function, the generated file declares a <Name>FunctionType
+// TypeName, a New<Name> constructor that initializes all of the
+// states, a Spec method returning the StatefulFunctionSpec with all
+// of the states registered, and typed Get, Set and Remove accessors
+// for every state.
+//
+// Usage:
+//
+//	statefun-gen [-output statefun_gen.go] [packages]
+//
+// Packages are directories, and a trailing /... includes all of
+// their subdirectories. The default is the current directory, which
+// allows it to be run through go generate:
+//
+//	//go:generate go run statefun-sdk-go/cmd/statefun-gen
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	output := flag.String("output", "statefun_gen.go", "the name of the generated file in each package")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: statefun-gen [-output file] [packages]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	if err := run(patterns, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "statefun-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(patterns []string, output string) error {
+	var dirs []string
+	for _, pattern := range patterns {
+		root, recursive := strings.CutSuffix(pattern, "/...")
+		if !recursive {
+			dirs = append(dirs, pattern)
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() {
+				if path != root && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "testdata" || entry.Name() == "vendor") {
+					return filepath.SkipDir
+				}
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range dirs {
+		source, err := generate(dir, output)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+
+		if source == nil {
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, output), source, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,10 +1,15 @@
+//go:generate go run statefun-sdk-go/cmd/statefun-gen
+
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"statefun-sdk-go/pkg/statefun"
+	"time"
 )
 
 type GreetRequest struct {
@@ -14,22 +19,22 @@ type GreetRequest struct {
 
 var GreetRequestType = statefun.MakeJsonType(statefun.TypeNameFrom("example/GreetRequest"))
 
-var PersonFunc = statefun.TypeNameFrom("example/person")
+var PersonFunc = PersonFunctionType
 
 var GreeterFunc = statefun.TypeNameFrom("example/greeter")
 
 var KafkaEgress = statefun.TypeNameFrom("example/greets")
 
+//statefun:function example/person
 type Person struct {
-	Visits statefun.ValueSpec
+	Visits statefun.ValueSpec `statefun:"visits,type=statefun.Int32Type"`
 }
 
 func (p Person) Invoke(ctx statefun.Context, msg statefun.Message) error {
 
-	var visits int32
-	_ = ctx.Storage().Get(p.Visits, &visits)
+	visits, _ := p.GetVisits(ctx)
 	visits += 1
-	ctx.Storage().Set(p.Visits, visits)
+	p.SetVisits(ctx, visits)
 
 	request := GreetRequest{}
 	_ = msg.As(GreetRequestType, &request)
@@ -73,26 +78,46 @@ func computeGreeting(name string, seen int32) string {
 	return fmt.Sprintf("Nice to see you for the %dth time %s", seen, name)
 }
 
-func main() {
-
+// Registers the example functions with a new StatefulFunctions registry.
+func newFunctions() (statefun.StatefulFunctions, error) {
 	builder := statefun.StatefulFunctionsBuilder()
 
-	person := Person{
-		Visits: statefun.ValueSpec{
-			Name:      "visits",
-			ValueType: statefun.Int32Type,
-		}}
-
-	_ = builder.WithSpec(statefun.StatefulFunctionSpec{
-		FunctionType: PersonFunc,
-		States:       []statefun.ValueSpec{person.Visits},
-		Function:     person,
-	})
+	if err := builder.WithSpec(NewPerson().Spec()); err != nil {
+		return nil, err
+	}
 
-	_ = builder.WithSpec(statefun.StatefulFunctionSpec{
+	if err := builder.WithSpec(statefun.StatefulFunctionSpec{
 		FunctionType: GreeterFunc,
 		Function:     statefun.StatefulFunctionPointer(greeter),
-	})
+	}); err != nil {
+		return nil, err
+	}
+
+	return builder, nil
+}
+
+// The endpoint the runtime uses to reach the example functions,
+// rendered into module.yaml by running with the -module flag.
+var endpoint = statefun.Endpoint{
+	UrlPathTemplate: "http://greeter:8000/statefun",
+	CallTimeout:     time.Minute,
+}
+
+func main() {
+	module := flag.Bool("module", false, "write the remote module specification to stdout and exit")
+	flag.Parse()
+
+	builder, err := newFunctions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *module {
+		if err := builder.WriteModuleYaml(os.Stdout, endpoint); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	http.Handle("/statefun", builder.AsHandler())
 	log.Fatal(http.ListenAndServe(":8000", nil))
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"statefun-sdk-go/pkg/statefun"
+	"statefun-sdk-go/pkg/statefun/statefuntest"
+	"testing"
+)
+
+func TestGreeter(t *testing.T) {
+	functions, err := newFunctions()
+	assert.NoError(t, err)
+
+	runtime := statefuntest.NewRuntime(functions)
+
+	for _, name := range []string{"bob", "alice", "bob"} {
+		err = runtime.Send(statefun.MessageBuilder{
+			Target: statefun.Address{
+				FunctionType: PersonFunc,
+				Id:           name,
+			},
+			Value:     GreetRequest{Name: name},
+			ValueType: GreetRequestType,
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, runtime.Run(context.Background()))
+
+	var greetings []string
+	for _, egress := range runtime.Egresses() {
+		assert.Equal(t, KafkaEgress.String(), egress.Target.String())
+
+		record, err := egress.AsKafkaRecord()
+		assert.NoError(t, err)
+		assert.Equal(t, "greetings", record.Topic)
+		greetings = append(greetings, string(record.Value))
+	}
+
+	assert.ElementsMatch(t, []string{
+		"Welcome bob",
+		"Nice to see you again bob",
+		"Welcome alice",
+	}, greetings)
+
+	var visits int32
+	assert.True(t, runtime.State(statefun.Address{FunctionType: PersonFunc, Id: "bob"}, statefun.ValueSpec{
+		Name:      "visits",
+		ValueType: statefun.Int32Type,
+	}, &visits))
+	assert.Equal(t, int32(2), visits)
+}
+
+func TestModuleYaml(t *testing.T) {
+	functions, err := newFunctions()
+	assert.NoError(t, err)
+
+	buffer := bytes.Buffer{}
+	assert.NoError(t, functions.WriteModuleYaml(&buffer, endpoint))
+
+	expected, err := os.ReadFile("module.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), buffer.String(), "module.yaml is out of date, regenerate it with: go run . -module > module.yaml")
+}
@@ -0,0 +1,46 @@
+// Code generated by statefun-gen. DO NOT EDIT.
+
+package main
+
+import (
+	"statefun-sdk-go/pkg/statefun"
+)
+
+// PersonFunctionType is the TypeName of the Person function.
+var PersonFunctionType = statefun.TypeNameFrom("example/person")
+
+// Creates a new Person with all of its states initialized.
+func NewPerson() Person {
+	return Person{
+		Visits: statefun.ValueSpec{
+			Name:      "visits",
+			ValueType: statefun.Int32Type,
+		},
+	}
+}
+
+// Returns the StatefulFunctionSpec of Person, with all of its states registered.
+func (p Person) Spec() statefun.StatefulFunctionSpec {
+	return statefun.StatefulFunctionSpec{
+		FunctionType: PersonFunctionType,
+		States: []statefun.ValueSpec{
+			p.Visits,
+		},
+		Function: p,
+	}
+}
+
+// Gets the visits state, returning false if it has no value.
+func (p Person) GetVisits(ctx statefun.Context) (int32, bool) {
+	return statefun.Value[int32]{ValueSpec: p.Visits}.Get(ctx)
+}
+
+// Sets the visits state.
+func (p Person) SetVisits(ctx statefun.Context, value int32) {
+	statefun.Value[int32]{ValueSpec: p.Visits}.Set(ctx, value)
+}
+
+// Removes the visits state.
+func (p Person) RemoveVisits(ctx statefun.Context) {
+	statefun.Value[int32]{ValueSpec: p.Visits}.Remove(ctx)
+}
@@ -0,0 +1,338 @@
+package statefun
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/hamba/avro/v2"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// A SchemaRegistry assigns ids to Avro schemas, in the manner
+// of the Confluent Schema Registry. It is used by Avro types
+// created with WithSchemaRegistry to read and write records in
+// the Confluent wire format.
+type SchemaRegistry interface {
+	// Registers the schema under the given subject and returns
+	// its id. Registering the same schema again returns the same id.
+	Register(subject string, schema string) (int, error)
+
+	// Returns the schema with the given id.
+	Schema(id int) (string, error)
+}
+
+// An InMemorySchemaRegistry is a SchemaRegistry that stores schemas
+// in memory. It is a local stand-in for a schema registry service,
+// useful for tests and for applications that do not share schemas
+// with other systems.
+type InMemorySchemaRegistry struct {
+	mutex    sync.Mutex
+	schemas  []string
+	ids      map[string]int
+	subjects map[string][]int
+}
+
+// Creates a new, empty InMemorySchemaRegistry.
+func NewInMemorySchemaRegistry() *InMemorySchemaRegistry {
+	return &InMemorySchemaRegistry{
+		ids:      map[string]int{},
+		subjects: map[string][]int{},
+	}
+}
+
+func (r *InMemorySchemaRegistry) Register(subject string, schema string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	id, exists := r.ids[schema]
+	if !exists {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+		r.ids[schema] = id
+	}
+
+	for _, registered := range r.subjects[subject] {
+		if registered == id {
+			return id, nil
+		}
+	}
+
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id, nil
+}
+
+func (r *InMemorySchemaRegistry) Schema(id int) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if id < 1 || id > len(r.schemas) {
+		return "", fmt.Errorf("unknown schema id %d", id)
+	}
+
+	return r.schemas[id-1], nil
+}
+
+// Returns the ids of all schemas registered under the
+// given subject, in the order they were registered.
+func (r *InMemorySchemaRegistry) Versions(subject string) []int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]int(nil), r.subjects[subject]...)
+}
+
+// An AvroOption configures a SimpleType created by MakeAvroType.
+type AvroOption func(*avroType) error
+
+// Registers previous versions of the schema, so that values written
+// with them can be read using the current schema. Because a plain
+// Avro payload does not identify the schema it was written with,
+// this option requires WithFingerprint.
+func WithWriterSchemas(schemas ...string) AvroOption {
+	return func(a *avroType) error {
+		for _, schema := range schemas {
+			parsed, err := parseAvroSchema(schema)
+			if err != nil {
+				return err
+			}
+
+			a.writers[fingerprint(parsed)] = parsed
+		}
+		return nil
+	}
+}
+
+// Writes values using the Avro single object encoding, which
+// prefixes each payload with the CRC-64-AVRO fingerprint of the
+// schema it was written with. When reading, the fingerprint selects
+// the writer schema, which must be either the current schema or
+// one registered with WithWriterSchemas. Payloads without a
+// fingerprint are read as if written with the current schema.
+func WithFingerprint() AvroOption {
+	return func(a *avroType) error {
+		a.fingerprinted = true
+		return nil
+	}
+}
+
+// Writes values in the Confluent wire format, which prefixes each
+// payload with the id of its schema in the registry. The schema is
+// registered under the given subject when the type is created; by
+// Confluent convention the subject of a Kafka record value is
+// "<topic>-value". When reading, the writer schema is looked up in
+// the registry by id.
+func WithSchemaRegistry(registry SchemaRegistry, subject string) AvroOption {
+	return func(a *avroType) error {
+		id, err := registry.Register(subject, a.schema.String())
+		if err != nil {
+			return fmt.Errorf("failed to register schema for %s: %w", subject, err)
+		}
+
+		a.registry = registry
+		a.id = id
+		return nil
+	}
+}
+
+const (
+	confluentMagicByte = 0x00
+	confluentHeaderLen = 5
+
+	singleObjectHeaderLen = 10
+)
+
+var singleObjectMagic = [2]byte{0xC3, 0x01}
+
+type avroType struct {
+	typeName TypeName
+	schema   avro.Schema
+
+	fingerprinted bool
+	writers       map[uint64]avro.Schema
+
+	registry SchemaRegistry
+	id       int
+
+	mutex    sync.Mutex
+	resolved map[[32]byte]avro.Schema
+	ids      map[int]avro.Schema
+}
+
+// Creates a new SimpleType with a given TypeName that serializes
+// values using the Avro binary encoding of the given schema. Values
+// are mapped to Go types as described by github.com/hamba/avro,
+// using the `avro` struct tag to name record fields.
+//
+// Values written with a different, compatible, version of the schema
+// are resolved against the current schema according to the Avro
+// schema resolution rules; see WithFingerprint and WithSchemaRegistry.
+//
+//	var UserType, _ = statefun.MakeAvroType(
+//		statefun.TypeNameFrom("com.example/User"),
+//		`{"type": "record", "name": "User", "fields": [{"name": "name", "type": "string"}]}`,
+//		statefun.WithSchemaRegistry(registry, "users-value"))
+func MakeAvroType(typeName TypeName, schema string, options ...AvroOption) (SimpleType, error) {
+	parsed, err := parseAvroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &avroType{
+		typeName: typeName,
+		schema:   parsed,
+		writers:  map[uint64]avro.Schema{fingerprint(parsed): parsed},
+		resolved: map[[32]byte]avro.Schema{},
+		ids:      map[int]avro.Schema{},
+	}
+
+	for _, option := range options {
+		if err := option(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.fingerprinted && a.registry != nil {
+		return nil, errors.New("an Avro type cannot use both WithFingerprint and WithSchemaRegistry")
+	}
+
+	if len(a.writers) > 1 && !a.fingerprinted {
+		return nil, errors.New("WithWriterSchemas requires WithFingerprint")
+	}
+
+	return a, nil
+}
+
+func (a *avroType) GetTypeName() TypeName {
+	return a.typeName
+}
+
+func (a *avroType) Deserialize(r io.Reader, receiver interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	writer := a.schema
+	switch {
+	case a.registry != nil:
+		if len(data) < confluentHeaderLen || data[0] != confluentMagicByte {
+			return errors.New("value is not in the Confluent wire format")
+		}
+
+		if writer, err = a.schemaById(int(binary.BigEndian.Uint32(data[1:confluentHeaderLen]))); err != nil {
+			return err
+		}
+		data = data[confluentHeaderLen:]
+
+	case a.fingerprinted && len(data) >= singleObjectHeaderLen && data[0] == singleObjectMagic[0] && data[1] == singleObjectMagic[1]:
+		id := binary.LittleEndian.Uint64(data[2:singleObjectHeaderLen])
+		schema, exists := a.writers[id]
+		if !exists {
+			return fmt.Errorf("unknown writer schema with fingerprint %x", id)
+		}
+
+		writer = schema
+		data = data[singleObjectHeaderLen:]
+	}
+
+	reader, err := a.resolve(writer)
+	if err != nil {
+		return err
+	}
+
+	return avro.Unmarshal(reader, data, receiver)
+}
+
+func (a *avroType) Serialize(writer io.Writer, data interface{}) error {
+	value, err := avro.Marshal(a.schema, data)
+	if err != nil {
+		return err
+	}
+
+	var header []byte
+	switch {
+	case a.registry != nil:
+		header = make([]byte, confluentHeaderLen)
+		header[0] = confluentMagicByte
+		binary.BigEndian.PutUint32(header[1:], uint32(a.id))
+	case a.fingerprinted:
+		header = make([]byte, singleObjectHeaderLen)
+		copy(header, singleObjectMagic[:])
+		binary.LittleEndian.PutUint64(header[2:], fingerprint(a.schema))
+	}
+
+	if _, err = writer.Write(header); err != nil {
+		return err
+	}
+
+	_, err = writer.Write(value)
+	return err
+}
+
+// Returns the schema to read values written with the given writer
+// schema, resolving the writer schema against the current schema.
+func (a *avroType) resolve(writer avro.Schema) (avro.Schema, error) {
+	if writer.Fingerprint() == a.schema.Fingerprint() {
+		return a.schema, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if resolved, exists := a.resolved[writer.Fingerprint()]; exists {
+		return resolved, nil
+	}
+
+	resolved, err := avro.NewSchemaCompatibility().Resolve(a.schema, writer)
+	if err != nil {
+		return nil, fmt.Errorf("writer schema is incompatible with %s: %w", a.typeName, err)
+	}
+
+	a.resolved[writer.Fingerprint()] = resolved
+	return resolved, nil
+}
+
+func (a *avroType) schemaById(id int) (avro.Schema, error) {
+	if id == a.id {
+		return a.schema, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if schema, exists := a.ids[id]; exists {
+		return schema, nil
+	}
+
+	schema, err := a.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := parseAvroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	a.ids[id] = parsed
+	return parsed, nil
+}
+
+// Parses the schema with its own cache, so that different versions
+// of the same named type do not overwrite each other.
+func parseAvroSchema(schema string) (avro.Schema, error) {
+	parsed, err := avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+
+	return parsed, nil
+}
+
+// Returns the CRC-64-AVRO fingerprint of the schema.
+func fingerprint(schema avro.Schema) uint64 {
+	sum, _ := schema.FingerprintUsing(avro.CRC64Avro)
+	return binary.BigEndian.Uint64(sum)
+}
@@ -0,0 +1,118 @@
+package statefun
+
+import (
+	"bytes"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"testing"
+)
+
+const userSchemaV1 = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "org.foo",
+	"fields": [
+		{"name": "name", "type": "string"}
+	]
+}`
+
+const userSchemaV2 = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "org.foo",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "visits", "type": "int", "default": 0}
+	]
+}`
+
+type avroUserV1 struct {
+	Name string `avro:"name"`
+}
+
+type avroUserV2 struct {
+	Name   string `avro:"name"`
+	Visits int32  `avro:"visits"`
+}
+
+func TestAvroType(t *testing.T) {
+	userType, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV2)
+	assert.NoError(t, err)
+	assert.Equal(t, "org.foo/User", userType.GetTypeName().String())
+
+	buffer := bytes.Buffer{}
+	err = userType.Serialize(&buffer, avroUserV2{Name: "bob", Visits: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x06, 'b', 'o', 'b', 0x06}, buffer.Bytes())
+
+	var user avroUserV2
+	err = userType.Deserialize(&buffer, &user)
+	assert.NoError(t, err)
+	assert.Equal(t, avroUserV2{Name: "bob", Visits: 3}, user)
+
+	_, err = MakeAvroType(TypeNameFrom("org.foo/User"), `{"type": "unknown"}`)
+	assert.Error(t, err)
+}
+
+func TestAvroFingerprintSchemaEvolution(t *testing.T) {
+	v1, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV1, WithFingerprint())
+	assert.NoError(t, err)
+
+	buffer := bytes.Buffer{}
+	err = v1.Serialize(&buffer, avroUserV1{Name: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xC3, 0x01}, buffer.Bytes()[:2], "value should use the single object encoding")
+	written := buffer.Bytes()
+
+	v2, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV2, WithFingerprint(), WithWriterSchemas(userSchemaV1))
+	assert.NoError(t, err)
+
+	var user avroUserV2
+	err = v2.Deserialize(bytes.NewReader(written), &user)
+	assert.NoError(t, err)
+	assert.Equal(t, avroUserV2{Name: "bob", Visits: 0}, user, "missing fields should use the reader default")
+
+	unknown, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV2, WithFingerprint())
+	assert.NoError(t, err)
+	err = unknown.Deserialize(bytes.NewReader(written), &user)
+	assert.Error(t, err, "values written with an unregistered schema cannot be read")
+
+	_, err = MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV2, WithWriterSchemas(userSchemaV1))
+	assert.Error(t, err, "writer schemas require fingerprints")
+}
+
+func TestAvroSchemaRegistry(t *testing.T) {
+	registry := NewInMemorySchemaRegistry()
+
+	v1, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV1, WithSchemaRegistry(registry, "users-value"))
+	assert.NoError(t, err)
+
+	v2, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV2, WithSchemaRegistry(registry, "users-value"))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, registry.Versions("users-value"))
+
+	again, err := MakeAvroType(TypeNameFrom("org.foo/User"), userSchemaV1, WithSchemaRegistry(registry, "users-value"))
+	assert.NoError(t, err)
+	assert.Equal(t, v1.(*avroType).id, again.(*avroType).id, "registering a schema twice should return the same id")
+
+	egress, err := KafkaEgressBuilder{
+		Target:    TypeNameFrom("org.foo/egress"),
+		Topic:     "users",
+		Value:     avroUserV1{Name: "bob"},
+		ValueType: v1,
+	}.toEgressMessage()
+	assert.NoError(t, err)
+
+	var record protocol.KafkaProducerRecord
+	assert.NoError(t, proto.Unmarshal(egress.Argument.Value, &record))
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x06, 'b', 'o', 'b'}, record.ValueBytes)
+
+	var user avroUserV2
+	err = v2.Deserialize(bytes.NewReader(record.ValueBytes), &user)
+	assert.NoError(t, err)
+	assert.Equal(t, avroUserV2{Name: "bob"}, user)
+
+	err = v2.Deserialize(bytes.NewReader([]byte{0x06, 'b', 'o', 'b'}), &user)
+	assert.Error(t, err, "values without the Confluent header cannot be read")
+}
@@ -0,0 +1,536 @@
+package statefun
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Creates the TypeName of a collection of elements of the given type,
+// for example io.statefun.sdk.go/list<io.statefun.types.int>. The
+// collections are specific to the Go SDK, so their names are kept
+// out of the io.statefun.types namespace shared by all SDKs.
+func collectionTypeName(kind string, elementType SimpleType) TypeName {
+	element := strings.ReplaceAll(elementType.GetTypeName().String(), "/", ".")
+	name, _ := TypeNameFromParts("io.statefun.sdk.go", kind+"<"+element+">")
+	return name
+}
+
+const (
+	listElements protowire.Number = 1
+
+	mapEntries    protowire.Number = 1
+	mapEntryKey   protowire.Number = 1
+	mapEntryValue protowire.Number = 2
+)
+
+// A SimpleType for a list of serialized elements, encoded as the
+// protobuf message:
+//
+//	message List {
+//	  repeated bytes elements = 1;
+//	}
+//
+// Because repeated fields may be concatenated, a single encoded
+// element can be appended to an encoded list without decoding it.
+type listType struct {
+	typeName TypeName
+}
+
+func (l listType) GetTypeName() TypeName {
+	return l.typeName
+}
+
+func (l listType) Deserialize(r io.Reader, receiver interface{}) error {
+	elements, ok := receiver.(*[][]byte)
+	if !ok {
+		return errors.New("receiver must be of type *[][]byte")
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	*elements = (*elements)[:0]
+	return consumeMessage(data, func(number protowire.Number, field []byte) error {
+		if number == listElements {
+			*elements = append(*elements, field)
+		}
+		return nil
+	})
+}
+
+func (l listType) Serialize(writer io.Writer, data interface{}) error {
+	elements, ok := data.([][]byte)
+	if !ok {
+		return errors.New("data must be of type [][]byte")
+	}
+
+	var buffer []byte
+	for _, element := range elements {
+		buffer = appendListElement(buffer, element)
+	}
+
+	_, err := writer.Write(buffer)
+	return err
+}
+
+func appendListElement(buffer []byte, element []byte) []byte {
+	buffer = protowire.AppendTag(buffer, listElements, protowire.BytesType)
+	return protowire.AppendBytes(buffer, element)
+}
+
+type mapEntry struct {
+	key   string
+	value []byte
+}
+
+// A SimpleType for a map of string keys to serialized values,
+// encoded as the protobuf message:
+//
+//	message Map {
+//	  message Entry {
+//	    string key = 1;
+//	    bytes value = 2;
+//	  }
+//	  repeated Entry entries = 1;
+//	}
+//
+// Entries are encoded in insertion order.
+type mapType struct {
+	typeName TypeName
+}
+
+func (m mapType) GetTypeName() TypeName {
+	return m.typeName
+}
+
+func (m mapType) Deserialize(r io.Reader, receiver interface{}) error {
+	entries, ok := receiver.(*[]mapEntry)
+	if !ok {
+		return errors.New("receiver must be of type *[]mapEntry")
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	*entries = (*entries)[:0]
+	return consumeMessage(data, func(number protowire.Number, field []byte) error {
+		if number != mapEntries {
+			return nil
+		}
+
+		var entry mapEntry
+		err := consumeMessage(field, func(number protowire.Number, field []byte) error {
+			switch number {
+			case mapEntryKey:
+				entry.key = string(field)
+			case mapEntryValue:
+				entry.value = field
+			}
+			return nil
+		})
+
+		*entries = append(*entries, entry)
+		return err
+	})
+}
+
+func (m mapType) Serialize(writer io.Writer, data interface{}) error {
+	entries, ok := data.([]mapEntry)
+	if !ok {
+		return errors.New("data must be of type []mapEntry")
+	}
+
+	var buffer, entry []byte
+	for _, e := range entries {
+		entry = entry[:0]
+		entry = protowire.AppendTag(entry, mapEntryKey, protowire.BytesType)
+		entry = protowire.AppendString(entry, e.key)
+		entry = protowire.AppendTag(entry, mapEntryValue, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, e.value)
+
+		buffer = protowire.AppendTag(buffer, mapEntries, protowire.BytesType)
+		buffer = protowire.AppendBytes(buffer, entry)
+	}
+
+	_, err := writer.Write(buffer)
+	return err
+}
+
+// Calls fn with each length-delimited field of a protobuf message,
+// skipping fields of other wire types.
+func consumeMessage(data []byte, fn func(number protowire.Number, field []byte) error) error {
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if wireType != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		field, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(number, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A ListValueSpec is a persisted list of elements of type T. Each
+// element is serialized with the element SimpleType, and the list
+// is stored as a single value so it can be registered like any
+// other ValueSpec, by adding the embedded ValueSpec to a
+// StatefulFunctionSpec.
+//
+//	var History = statefun.MakeListValueSpec[string]("history", statefun.StringType)
+//
+//	statefun.StatefulFunctionSpec{
+//		States: []statefun.ValueSpec{History.ValueSpec},
+//		...
+//	}
+//
+//	History.Append(ctx, "hello")
+//
+// Appending writes only the new element; all other modifications
+// rewrite the list. The state is only written back to the runtime
+// if it was modified during the invocation. The list format is
+// specific to the Go SDK, so the state cannot be read by functions
+// written with the other StateFun SDKs.
+type ListValueSpec[T any] struct {
+	ValueSpec
+	elementType SimpleType
+}
+
+// Creates a new ListValueSpec with the given name, whose elements
+// are serialized with the given SimpleType. An Expiration may be
+// configured through the embedded ValueSpec.
+func MakeListValueSpec[T any](name string, elementType SimpleType) ListValueSpec[T] {
+	return ListValueSpec[T]{
+		ValueSpec: ValueSpec{
+			Name:      name,
+			ValueType: listType{typeName: collectionTypeName("list", elementType)},
+		},
+		elementType: elementType,
+	}
+}
+
+// Appends the values to the end of the list.
+func (l ListValueSpec[T]) Append(ctx Context, values ...T) {
+	if len(values) == 0 {
+		return
+	}
+
+	var encoded []byte
+	for _, value := range values {
+		encoded = appendListElement(encoded, l.serialize(value))
+	}
+
+	if appender, ok := ctx.Storage().(interface {
+		append(spec ValueSpec, data []byte)
+	}); ok {
+		appender.append(l.ValueSpec, encoded)
+		return
+	}
+
+	elements := l.elements(ctx)
+	for _, value := range values {
+		elements = append(elements, l.serialize(value))
+	}
+	ctx.Storage().Set(l.ValueSpec, elements)
+}
+
+// Gets the element at the given index. The method returns
+// false if the index is out of range.
+func (l ListValueSpec[T]) Get(ctx Context, index int) (T, bool) {
+	elements := l.elements(ctx)
+	if index < 0 || index >= len(elements) {
+		var zero T
+		return zero, false
+	}
+
+	return l.deserialize(elements[index]), true
+}
+
+// Replaces the element at the given index. The method
+// returns false if the index is out of range.
+func (l ListValueSpec[T]) Set(ctx Context, index int, value T) bool {
+	elements := l.elements(ctx)
+	if index < 0 || index >= len(elements) {
+		return false
+	}
+
+	elements[index] = l.serialize(value)
+	ctx.Storage().Set(l.ValueSpec, elements)
+	return true
+}
+
+// Removes the element at the given index, shifting all subsequent
+// elements. The method returns false if the index is out of range.
+func (l ListValueSpec[T]) Remove(ctx Context, index int) bool {
+	elements := l.elements(ctx)
+	if index < 0 || index >= len(elements) {
+		return false
+	}
+
+	elements = append(elements[:index], elements[index+1:]...)
+	ctx.Storage().Set(l.ValueSpec, elements)
+	return true
+}
+
+// Returns the number of elements in the list.
+func (l ListValueSpec[T]) Size(ctx Context) int {
+	return len(l.elements(ctx))
+}
+
+// Calls fn for each element in order, until fn returns false.
+func (l ListValueSpec[T]) Range(ctx Context, fn func(index int, value T) bool) {
+	for i, element := range l.elements(ctx) {
+		if !fn(i, l.deserialize(element)) {
+			return
+		}
+	}
+}
+
+// Removes all elements from the list.
+func (l ListValueSpec[T]) Clear(ctx Context) {
+	ctx.Storage().Remove(l.ValueSpec)
+}
+
+func (l ListValueSpec[T]) elements(ctx Context) [][]byte {
+	var elements [][]byte
+	ctx.Storage().Get(l.ValueSpec, &elements)
+	return elements
+}
+
+func (l ListValueSpec[T]) serialize(value T) []byte {
+	return serializeElement(l.Name, l.elementType, value)
+}
+
+func (l ListValueSpec[T]) deserialize(data []byte) T {
+	var value T
+	deserializeElement(l.Name, l.elementType, data, &value)
+	return value
+}
+
+// A MapValueSpec is a persisted map from string keys to values of
+// type V. Each value is serialized with the value SimpleType, and
+// the map is stored as a single value so it can be registered like
+// any other ValueSpec, by adding the embedded ValueSpec to a
+// StatefulFunctionSpec.
+//
+//	var Scores = statefun.MakeMapValueSpec[int64]("scores", statefun.Int64Type)
+//
+//	Scores.Put(ctx, "alice", 10)
+//	score, ok := Scores.Get(ctx, "alice")
+//
+// Entries are kept in insertion order. The map is decoded on first
+// access and encoded once when it is written back, so reading and
+// modifying entries does not decode the whole map on every call.
+// The state is only written back to the runtime if it was modified
+// during the invocation. The map format is specific to the Go SDK, so the state cannot
+// be read by functions written with the other StateFun SDKs.
+type MapValueSpec[V any] struct {
+	ValueSpec
+	valueType SimpleType
+}
+
+// Creates a new MapValueSpec with the given name, whose values are
+// serialized with the given SimpleType. An Expiration may be
+// configured through the embedded ValueSpec.
+func MakeMapValueSpec[V any](name string, valueType SimpleType) MapValueSpec[V] {
+	return MapValueSpec[V]{
+		ValueSpec: ValueSpec{
+			Name:      name,
+			ValueType: mapType{typeName: collectionTypeName("map", valueType)},
+		},
+		valueType: valueType,
+	}
+}
+
+// Gets the value for the given key. The method
+// returns false if the key is not present.
+func (m MapValueSpec[V]) Get(ctx Context, key string) (V, bool) {
+	var value V
+	entries := m.read(ctx)
+	i, ok := entries.index[key]
+	if ok {
+		deserializeElement(m.Name, m.valueType, entries.entries[i].value, &value)
+	}
+
+	return value, ok
+}
+
+// Returns true if the key is present.
+func (m MapValueSpec[V]) Contains(ctx Context, key string) bool {
+	_, ok := m.read(ctx).index[key]
+	return ok
+}
+
+// Sets the value for the given key, replacing any existing value.
+func (m MapValueSpec[V]) Put(ctx Context, key string, value V) {
+	data := serializeElement(m.Name, m.valueType, value)
+	m.write(ctx, func(entries *decodedMap) {
+		entries.put(key, data)
+	})
+}
+
+// Removes the given key. The method returns
+// false if the key was not present.
+func (m MapValueSpec[V]) Remove(ctx Context, key string) bool {
+	if !m.Contains(ctx, key) {
+		return false
+	}
+
+	m.write(ctx, func(entries *decodedMap) {
+		entries.remove(key)
+	})
+	return true
+}
+
+// Returns the number of entries in the map.
+func (m MapValueSpec[V]) Size(ctx Context) int {
+	return len(m.read(ctx).entries)
+}
+
+// Calls fn for each entry in insertion order, until fn returns false.
+func (m MapValueSpec[V]) Range(ctx Context, fn func(key string, value V) bool) {
+	for _, entry := range m.read(ctx).entries {
+		var value V
+		deserializeElement(m.Name, m.valueType, entry.value, &value)
+		if !fn(entry.key, value) {
+			return
+		}
+	}
+}
+
+// Removes all entries from the map.
+func (m MapValueSpec[V]) Clear(ctx Context) {
+	ctx.Storage().Remove(m.ValueSpec)
+}
+
+// Implemented by the storage of the handler, which caches the decoded
+// map in its cell for the rest of the batch and encodes it once when
+// it is written back, instead of on every access.
+type cachingStorage interface {
+	cached(spec ValueSpec, decode func(data []byte) (interface{}, error)) interface{}
+
+	updateCached(
+		spec ValueSpec,
+		decode func(data []byte) (interface{}, error),
+		update func(value interface{}),
+		encode func(value interface{}) []byte,
+	)
+}
+
+func (m MapValueSpec[V]) read(ctx Context) *decodedMap {
+	if storage, ok := ctx.Storage().(cachingStorage); ok {
+		return storage.cached(m.ValueSpec, m.decode).(*decodedMap)
+	}
+
+	var entries []mapEntry
+	ctx.Storage().Get(m.ValueSpec, &entries)
+	return newDecodedMap(entries)
+}
+
+func (m MapValueSpec[V]) write(ctx Context, update func(entries *decodedMap)) {
+	if storage, ok := ctx.Storage().(cachingStorage); ok {
+		storage.updateCached(m.ValueSpec, m.decode, func(value interface{}) {
+			update(value.(*decodedMap))
+		}, m.encode)
+		return
+	}
+
+	entries := m.read(ctx)
+	update(entries)
+	ctx.Storage().Set(m.ValueSpec, entries.entries)
+}
+
+func (m MapValueSpec[V]) decode(data []byte) (interface{}, error) {
+	var entries []mapEntry
+	if err := m.ValueType.Deserialize(bytes.NewReader(data), &entries); err != nil {
+		return nil, err
+	}
+
+	return newDecodedMap(entries), nil
+}
+
+func (m MapValueSpec[V]) encode(value interface{}) []byte {
+	buffer := bytes.Buffer{}
+	_ = m.ValueType.Serialize(&buffer, value.(*decodedMap).entries)
+	return buffer.Bytes()
+}
+
+// The entries of a map in insertion order, indexed by key.
+type decodedMap struct {
+	entries []mapEntry
+	index   map[string]int
+}
+
+func newDecodedMap(entries []mapEntry) *decodedMap {
+	index := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		index[entry.key] = i
+	}
+
+	return &decodedMap{entries: entries, index: index}
+}
+
+func (d *decodedMap) put(key string, value []byte) {
+	if i, ok := d.index[key]; ok {
+		d.entries[i].value = value
+		return
+	}
+
+	d.index[key] = len(d.entries)
+	d.entries = append(d.entries, mapEntry{key: key, value: value})
+}
+
+func (d *decodedMap) remove(key string) {
+	i, ok := d.index[key]
+	if !ok {
+		return
+	}
+
+	d.entries = append(d.entries[:i], d.entries[i+1:]...)
+	delete(d.index, key)
+	for ; i < len(d.entries); i++ {
+		d.index[d.entries[i].key] = i
+	}
+}
+
+func serializeElement(name string, elementType SimpleType, value interface{}) []byte {
+	buffer := bytes.Buffer{}
+	if err := elementType.Serialize(&buffer, value); err != nil {
+		panic(fmt.Errorf("failed to serialize element of %s: %w", name, err))
+	}
+
+	return buffer.Bytes()
+}
+
+func deserializeElement(name string, elementType SimpleType, data []byte, receiver interface{}) {
+	if err := elementType.Deserialize(bytes.NewReader(data), receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize element of %s: %w", name, err))
+	}
+}
@@ -0,0 +1,183 @@
+package statefun
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"testing"
+)
+
+var (
+	History = MakeListValueSpec[string]("history", StringType)
+	Scores  = MakeMapValueSpec[int64]("scores", Int64Type)
+)
+
+func collectionContext(t *testing.T, specs ...ValueSpec) *statefunContext {
+	registered := make(map[string]*protocol.FromFunction_PersistedValueSpec, len(specs))
+	valueSpecs := make(map[string]ValueSpec, len(specs))
+	state := make([]*protocol.ToFunction_PersistedValue, 0, len(specs))
+	for _, spec := range specs {
+		valueSpecs[spec.Name] = spec
+		registered[spec.Name] = &protocol.FromFunction_PersistedValueSpec{
+			StateName:    spec.Name,
+			TypeTypename: spec.ValueType.GetTypeName().String(),
+		}
+		state = append(state, &protocol.ToFunction_PersistedValue{
+			StateName:  spec.Name,
+			StateValue: &protocol.TypedValue{Typename: spec.ValueType.GetTypeName().String()},
+		})
+	}
+
+	factory, err := newStorageFactory(&protocol.ToFunction_InvocationBatchRequest{State: state}, registered, valueSpecs)
+	assert.NoError(t, err)
+	assert.Nil(t, factory.getMissingSpecs())
+
+	return &statefunContext{Context: context.Background(), storage: factory.getStorage()}
+}
+
+func TestCollectionTypeNames(t *testing.T) {
+	assert.Equal(t, "io.statefun.sdk.go/list<io.statefun.types.string>", History.ValueType.GetTypeName().String())
+	assert.Equal(t, "io.statefun.sdk.go/map<io.statefun.types.long>", Scores.ValueType.GetTypeName().String())
+}
+
+func TestListValueSpec(t *testing.T) {
+	ctx := collectionContext(t, History.ValueSpec)
+
+	assert.Equal(t, 0, History.Size(ctx))
+	assert.Empty(t, ctx.storage.getStateMutations(), "reading should not mutate state")
+
+	History.Append(ctx, "a", "b")
+	History.Append(ctx, "c")
+	assert.Equal(t, 3, History.Size(ctx))
+
+	value, ok := History.Get(ctx, 1)
+	assert.True(t, ok)
+	assert.Equal(t, "b", value)
+
+	_, ok = History.Get(ctx, 3)
+	assert.False(t, ok)
+
+	assert.True(t, History.Set(ctx, 0, "z"))
+	assert.True(t, History.Remove(ctx, 1))
+	assert.False(t, History.Remove(ctx, 5))
+
+	var values []string
+	History.Range(ctx, func(_ int, value string) bool {
+		values = append(values, value)
+		return true
+	})
+	assert.Equal(t, []string{"z", "c"}, values)
+
+	History.Clear(ctx)
+	assert.Equal(t, 0, History.Size(ctx))
+}
+
+func TestListAppendEncoding(t *testing.T) {
+	ctx := collectionContext(t, History.ValueSpec)
+	History.Append(ctx, "a")
+	History.Append(ctx, "b")
+
+	mutations := ctx.storage.getStateMutations()
+	assert.Len(t, mutations, 1)
+	assert.Equal(t, protocol.FromFunction_PersistedValueMutation_MODIFY, mutations[0].MutationType)
+
+	a, b := bytes.Buffer{}, bytes.Buffer{}
+	_ = StringType.Serialize(&a, "a")
+	_ = StringType.Serialize(&b, "b")
+
+	expected := bytes.Buffer{}
+	err := History.ValueType.Serialize(&expected, [][]byte{a.Bytes(), b.Bytes()})
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Bytes(), mutations[0].StateValue.Value, "appended elements should be encoded as a single list")
+}
+
+func TestMapValueSpec(t *testing.T) {
+	ctx := collectionContext(t, Scores.ValueSpec)
+
+	_, ok := Scores.Get(ctx, "alice")
+	assert.False(t, ok)
+	assert.Empty(t, ctx.storage.getStateMutations(), "reading should not mutate state")
+
+	Scores.Put(ctx, "alice", 10)
+	Scores.Put(ctx, "bob", 5)
+	Scores.Put(ctx, "alice", 12)
+
+	score, ok := Scores.Get(ctx, "alice")
+	assert.True(t, ok)
+	assert.Equal(t, int64(12), score)
+	assert.True(t, Scores.Contains(ctx, "bob"))
+	assert.Equal(t, 2, Scores.Size(ctx))
+
+	var keys []string
+	Scores.Range(ctx, func(key string, _ int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	assert.Equal(t, []string{"alice", "bob"}, keys, "entries should be kept in insertion order")
+
+	assert.True(t, Scores.Remove(ctx, "alice"))
+	assert.False(t, Scores.Remove(ctx, "alice"))
+	assert.Equal(t, 1, Scores.Size(ctx))
+
+	Scores.Clear(ctx)
+	assert.Equal(t, 0, Scores.Size(ctx))
+	assert.Equal(t, protocol.FromFunction_PersistedValueMutation_DELETE, ctx.storage.getStateMutations()[0].MutationType)
+}
+
+func TestMapCacheIsWrittenBack(t *testing.T) {
+	ctx := collectionContext(t, Scores.ValueSpec)
+	ctx.storage.checkpoint()
+
+	Scores.Put(ctx, "alice", 10)
+	Scores.Put(ctx, "bob", 5)
+	assert.True(t, Scores.Remove(ctx, "alice"))
+	Scores.Put(ctx, "carol", 7)
+
+	var entries []mapEntry
+	assert.True(t, ctx.storage.Get(Scores.ValueSpec, &entries), "reading the raw value should encode the cached map")
+	assert.Equal(t, []string{"bob", "carol"}, []string{entries[0].key, entries[1].key})
+
+	mutations := ctx.storage.getStateMutations()
+	assert.Len(t, mutations, 1)
+
+	expected := bytes.Buffer{}
+	err := Scores.ValueType.Serialize(&expected, entries)
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Bytes(), mutations[0].StateValue.Value)
+}
+
+func TestMapCacheRollback(t *testing.T) {
+	ctx := collectionContext(t, Scores.ValueSpec)
+	ctx.storage.checkpoint()
+	Scores.Put(ctx, "alice", 10)
+
+	// a failed invocation modifies the cached map in place
+	ctx.storage.checkpoint()
+	Scores.Put(ctx, "alice", 99)
+	Scores.Put(ctx, "bob", 5)
+	ctx.storage.rollback()
+
+	score, _ := Scores.Get(ctx, "alice")
+	assert.Equal(t, int64(10), score)
+	assert.False(t, Scores.Contains(ctx, "bob"))
+}
+
+func TestMapCacheIsNotShared(t *testing.T) {
+	ctx := collectionContext(t, Scores.ValueSpec)
+	ctx.response = &protocol.FromFunction_InvocationResponse{}
+	Scores.Put(ctx, "alice", 10)
+
+	detached := ctx.detach()
+	Scores.Put(detached, "alice", 99)
+	Scores.Put(detached, "bob", 5)
+
+	score, _ := Scores.Get(ctx, "alice")
+	assert.Equal(t, int64(10), score, "a fork should not modify the cached map of the original")
+	assert.Equal(t, 1, Scores.Size(ctx))
+
+	ctx.merge(detached)
+	score, _ = Scores.Get(ctx, "alice")
+	assert.Equal(t, int64(99), score)
+	assert.Equal(t, 2, Scores.Size(ctx))
+}
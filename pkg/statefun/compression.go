@@ -0,0 +1,319 @@
+package statefun
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// A CompressionCodec is the algorithm used to compress
+// the values of a SimpleType created by Compressed.
+type CompressionCodec byte
+
+// The codec of every value is written to its header,
+// so these values must never change.
+const (
+	NoCompression CompressionCodec = iota
+	GzipCompression
+	ZstdCompression
+	SnappyCompression
+)
+
+func (c CompressionCodec) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case GzipCompression:
+		return "gzip"
+	case ZstdCompression:
+		return "zstd"
+	case SnappyCompression:
+		return "snappy"
+	default:
+		return fmt.Sprintf("CompressionCodec(%d)", byte(c))
+	}
+}
+
+// The marker that prefixes every value written by a compressed type.
+var compressionMarker = [2]byte{0xFE, 0x43}
+
+// The default maximum size of a decompressed value.
+const defaultMaxDecompressedSize = 64 << 20
+
+// A CompressionOption configures a SimpleType created by Compressed.
+type CompressionOption func(*compressedType)
+
+// Writes values smaller than the given number of bytes, before
+// compression, uncompressed. Compressing small values rarely
+// saves space and costs CPU on every read and write.
+func WithMinCompressedSize(size int) CompressionOption {
+	return func(c *compressedType) {
+		c.minSize = size
+	}
+}
+
+// Sets the maximum size, in bytes, of a value after decompression.
+// Reading a value that decompresses to more than the maximum fails
+// before it is fully decompressed, so that a small corrupt or
+// malicious value cannot exhaust memory. The default is 64 MiB.
+func WithMaxDecompressedSize(size int) CompressionOption {
+	return func(c *compressedType) {
+		c.maxSize = size
+	}
+}
+
+type compressedType struct {
+	inner   SimpleType
+	codec   CompressionCodec
+	minSize int
+	maxSize int
+}
+
+// Wraps a SimpleType to compress its values with the given codec,
+// for large values such as JSON documents held in a ValueSpec.
+//
+//	var ProfileType = statefun.Compressed(statefun.MakeJsonType(ProfileTypeName), statefun.ZstdCompression)
+//
+// The codec is chosen per value: each value is written with a
+// small header holding the codec it was compressed with, and values
+// are written uncompressed if compressing them does not make them
+// smaller, or if they are smaller than the WithMinCompressedSize
+// option. Values are always read with the codec of their header, so
+// the codec may be changed without rewriting existing values.
+//
+// The type keeps the TypeName of the wrapped type, and values that
+// have no header, written by the wrapped SimpleType before it was
+// compressed, are read as is. This allows compression to be enabled
+// for existing state; values are compressed as they are rewritten.
+// A wrapped VersionedType upgrades persisted state as usual, and the
+// upgraded value is written back compressed.
+func Compressed(inner SimpleType, codec CompressionCodec, options ...CompressionOption) SimpleType {
+	if codec > SnappyCompression {
+		panic(fmt.Errorf("unknown compression codec %d", byte(codec)))
+	}
+
+	c := &compressedType{
+		inner:   inner,
+		codec:   codec,
+		maxSize: defaultMaxDecompressedSize,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+func (c *compressedType) GetTypeName() TypeName {
+	return c.inner.GetTypeName()
+}
+
+func (c *compressedType) Deserialize(r io.Reader, receiver interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	payload, err := c.decode(data)
+	if err != nil {
+		return err
+	}
+
+	return c.inner.Deserialize(bytes.NewReader(payload), receiver)
+}
+
+func (c *compressedType) Serialize(writer io.Writer, data interface{}) error {
+	buffer := bytes.Buffer{}
+	if err := c.inner.Serialize(&buffer, data); err != nil {
+		return err
+	}
+
+	return c.encode(writer, buffer.Bytes())
+}
+
+// Returns the payload of a value, decompressed with the
+// codec of its header, or as is if it has no header.
+func (c *compressedType) decode(data []byte) ([]byte, error) {
+	if len(data) <= len(compressionMarker) || data[0] != compressionMarker[0] || data[1] != compressionMarker[1] {
+		return data, nil
+	}
+
+	codec := CompressionCodec(data[len(compressionMarker)])
+	payload, err := decompress(codec, data[len(compressionMarker)+1:], c.maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s value: %w", codec, err)
+	}
+
+	return payload, nil
+}
+
+// Writes the payload with a header, compressed
+// if that makes it smaller.
+func (c *compressedType) encode(writer io.Writer, payload []byte) error {
+	codec := NoCompression
+	if c.codec != NoCompression && len(payload) >= c.minSize {
+		compressed, err := compress(c.codec, payload)
+		if err != nil {
+			return fmt.Errorf("failed to compress %s value: %w", c.codec, err)
+		}
+
+		if len(compressed) < len(payload) {
+			codec, payload = c.codec, compressed
+		}
+	}
+
+	header := []byte{compressionMarker[0], compressionMarker[1], byte(codec)}
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(payload)
+	return err
+}
+
+// Upgrades a persisted value of the wrapped type, such as a
+// VersionedType, by decompressing it and compressing the
+// upgraded value. It returns nil if the value is already current.
+func (c *compressedType) upgrade(typeName string, data []byte) ([]byte, error) {
+	upgradable, ok := c.inner.(upgradableType)
+	if !ok {
+		return nil, nil
+	}
+
+	payload, err := c.decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	upgraded, err := upgradable.upgrade(typeName, payload)
+	if err != nil || upgraded == nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := c.encode(&buffer, upgraded); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Returns true if the wrapped type is able
+// to read values of the given TypeName.
+func (c *compressedType) matchesTypeName(typeName string) bool {
+	matcher, ok := c.inner.(typeNameMatcher)
+	return ok && matcher.matchesTypeName(typeName)
+}
+
+// The zstd encoder and decoders are safe for concurrent use
+// through EncodeAll and DecodeAll, and expensive to create,
+// so a decoder is shared by all types with the same maximum
+// decompressed size.
+var (
+	zstdOnce     sync.Once
+	zstdEncoder  *zstd.Encoder
+	zstdMutex    sync.Mutex
+	zstdDecoders = map[int]*zstd.Decoder{}
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+	})
+}
+
+func zstdDecoder(maxSize int) (*zstd.Decoder, error) {
+	zstdMutex.Lock()
+	defer zstdMutex.Unlock()
+
+	if decoder, ok := zstdDecoders[maxSize]; ok {
+		return decoder, nil
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(maxSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	zstdDecoders[maxSize] = decoder
+	return decoder, nil
+}
+
+func compress(codec CompressionCodec, data []byte) ([]byte, error) {
+	switch codec {
+	case GzipCompression:
+		buffer := bytes.Buffer{}
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		return buffer.Bytes(), nil
+	case ZstdCompression:
+		initZstd()
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case SnappyCompression:
+		return s2.EncodeSnappy(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec %d", byte(codec))
+	}
+}
+
+// Decompresses data, failing if the result
+// would be larger than maxSize bytes.
+func decompress(codec CompressionCodec, data []byte, maxSize int) ([]byte, error) {
+	switch codec {
+	case NoCompression:
+		return data, nil
+	case GzipCompression:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() { _ = reader.Close() }()
+		payload, err := ioutil.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(payload) > maxSize {
+			return nil, fmt.Errorf("decompressed value exceeds %d bytes", maxSize)
+		}
+		return payload, nil
+	case ZstdCompression:
+		decoder, err := zstdDecoder(maxSize)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := decoder.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) || len(payload) > maxSize {
+			return nil, fmt.Errorf("decompressed value exceeds %d bytes", maxSize)
+		}
+		return payload, err
+	case SnappyCompression:
+		size, err := s2.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if size > maxSize {
+			return nil, fmt.Errorf("decompressed value exceeds %d bytes", maxSize)
+		}
+		return s2.Decode(nil, data)
+	default:
+		return nil, errors.New("unknown compression codec")
+	}
+}
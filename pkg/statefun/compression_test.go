@@ -0,0 +1,116 @@
+package statefun
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type Document struct {
+	Body string `json:"body"`
+}
+
+var documentTypeName = TypeNameFrom("org.foo/Document")
+
+func TestCompressedType(t *testing.T) {
+	document := Document{Body: strings.Repeat("lorem ipsum dolor sit amet ", 1000)}
+
+	for _, codec := range []CompressionCodec{GzipCompression, ZstdCompression, SnappyCompression} {
+		compressed := Compressed(MakeJsonType(documentTypeName), codec)
+		assert.Equal(t, documentTypeName, compressed.GetTypeName())
+
+		buffer := bytes.Buffer{}
+		err := compressed.Serialize(&buffer, document)
+		assert.NoError(t, err, codec.String())
+		assert.Equal(t, []byte{0xFE, 0x43, byte(codec)}, buffer.Bytes()[:3], codec.String())
+		assert.Less(t, buffer.Len(), len(document.Body)/10, "%s should compress the document", codec)
+
+		var result Document
+		err = compressed.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+		assert.NoError(t, err, codec.String())
+		assert.Equal(t, document, result)
+	}
+}
+
+func TestCompressedTypeReadsAnyCodec(t *testing.T) {
+	document := Document{Body: strings.Repeat("a", 1000)}
+
+	buffer := bytes.Buffer{}
+	err := Compressed(MakeJsonType(documentTypeName), GzipCompression).Serialize(&buffer, document)
+	assert.NoError(t, err)
+
+	var result Document
+	err = Compressed(MakeJsonType(documentTypeName), ZstdCompression).Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err, "values should be read with the codec of their header")
+	assert.Equal(t, document, result)
+}
+
+func TestCompressedTypeReadsUncompressed(t *testing.T) {
+	compressed := Compressed(MakeJsonType(documentTypeName), ZstdCompression)
+
+	buffer := bytes.Buffer{}
+	err := MakeJsonType(documentTypeName).Serialize(&buffer, Document{Body: "legacy"})
+	assert.NoError(t, err)
+
+	var result Document
+	err = compressed.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err, "values written before compression was enabled should be readable")
+	assert.Equal(t, "legacy", result.Body)
+}
+
+func TestCompressedTypeSkipsSmallValues(t *testing.T) {
+	compressed := Compressed(MakeJsonType(documentTypeName), GzipCompression, WithMinCompressedSize(1024))
+
+	buffer := bytes.Buffer{}
+	err := compressed.Serialize(&buffer, Document{Body: strings.Repeat("a", 100)})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(NoCompression), buffer.Bytes()[2], "values below the minimum size should not be compressed")
+
+	var result Document
+	err = compressed.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 100), result.Body)
+}
+
+func TestCompressedTypeLimitsDecompressedSize(t *testing.T) {
+	document := Document{Body: strings.Repeat("a", 1<<20)}
+
+	for _, codec := range []CompressionCodec{GzipCompression, ZstdCompression, SnappyCompression} {
+		buffer := bytes.Buffer{}
+		err := Compressed(MakeJsonType(documentTypeName), codec).Serialize(&buffer, document)
+		assert.NoError(t, err, codec.String())
+
+		var result Document
+		limited := Compressed(MakeJsonType(documentTypeName), codec, WithMaxDecompressedSize(64<<10))
+		err = limited.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+		assert.ErrorContains(t, err, "exceeds", "%s should not decompress past the maximum size", codec)
+
+		err = Compressed(MakeJsonType(documentTypeName), codec).Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+		assert.NoError(t, err, codec.String())
+	}
+}
+
+func TestCompressedVersionedStateUpgrade(t *testing.T) {
+	spec := ValueSpec{Name: "user", ValueType: Compressed(versionedUserType(), GzipCompression)}
+
+	legacy := bytes.Buffer{}
+	err := Compressed(MakeJsonType(TypeNameFrom("org.foo/User")), GzipCompression).Serialize(&legacy, User{"bob", "mop"})
+	assert.NoError(t, err)
+
+	storage := versionedStorage(t, spec, "org.foo/User", legacy.Bytes())
+
+	var user userV2
+	assert.True(t, storage.Get(spec, &user))
+	assert.Equal(t, userV2{Name: "bob mop", Visits: 1}, user)
+
+	mutations := storage.getStateMutations()
+	assert.Len(t, mutations, 1, "upgraded state should be written back")
+	assert.Equal(t, "org.foo/User@v2", mutations[0].StateValue.Typename)
+	assert.Equal(t, []byte{0xFE, 0x43}, mutations[0].StateValue.Value[:2], "upgraded state should be compressed")
+
+	var written userV2
+	err = spec.ValueType.Deserialize(bytes.NewReader(mutations[0].StateValue.Value), &written)
+	assert.NoError(t, err)
+	assert.Equal(t, user, written)
+}
@@ -2,6 +2,7 @@ package statefun
 
 import (
 	"context"
+	"encoding/hex"
 	"statefun-sdk-go/pkg/statefun/internal/protocol"
 	"sync"
 	"time"
@@ -12,7 +13,8 @@ import (
 // the invocation such as send messages to other functions or egresses, and provides access to
 // AddressScopedStorage scoped to the current Address. This type is also a context.Context
 // and can be used to ensure any spawned go routines do not outlive the current function
-// invocation.
+// invocation. Its Deadline is the earlier of the function's Timeout and the batch timeout
+// of the StatefulFunctions registry, if either is set.
 type Context interface {
 	context.Context
 
@@ -35,6 +37,10 @@ type Context interface {
 	// The AddressScopedStorage, providing access to stored values scoped to the
 	// current invoked function instance's Address (which is obtainable using Self()).
 	Storage() AddressScopedStorage
+
+	// A Logger for the current invocation, tagged with
+	// the Self and, if applicable, Caller Address.
+	Logger() Logger
 }
 
 type statefunContext struct {
@@ -44,6 +50,43 @@ type statefunContext struct {
 	caller   *Address
 	storage  *storage
 	response *protocol.FromFunction_InvocationResponse
+	logger   Logger
+
+	tracer       Tracer
+	traceTargets map[string]bool
+	spanContext  SpanContext
+}
+
+// Returns a copy of the context with its own storage and
+// response, so that an invocation that outlives its batch
+// cannot modify the batch's side effects.
+func (s *statefunContext) detach() *statefunContext {
+	return &statefunContext{
+		Context:      s.Context,
+		self:         s.self,
+		caller:       s.caller,
+		storage:      s.storage.fork(),
+		response:     &protocol.FromFunction_InvocationResponse{},
+		logger:       s.logger,
+		tracer:       s.tracer,
+		traceTargets: s.traceTargets,
+		spanContext:  s.spanContext,
+	}
+}
+
+// Applies the side effects of a detached invocation
+// that completed within its deadline.
+func (s *statefunContext) merge(detached *statefunContext) {
+	detached.Lock()
+	defer detached.Unlock()
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.response.OutgoingMessages = append(s.response.OutgoingMessages, detached.response.OutgoingMessages...)
+	s.response.DelayedInvocations = append(s.response.DelayedInvocations, detached.response.DelayedInvocations...)
+	s.response.OutgoingEgresses = append(s.response.OutgoingEgresses, detached.response.OutgoingEgresses...)
+	s.storage.adopt(detached.storage)
 }
 
 func (s *statefunContext) Storage() AddressScopedStorage {
@@ -58,6 +101,34 @@ func (s *statefunContext) Caller() *Address {
 	return s.caller
 }
 
+func (s *statefunContext) Logger() Logger {
+	fields := []interface{}{"self", s.self.String()}
+	if s.caller != nil {
+		fields = append(fields, "caller", s.caller.String())
+	}
+
+	if s.spanContext.IsValid() {
+		fields = append(fields, "trace_id", hex.EncodeToString(s.spanContext.TraceID[:]))
+	}
+
+	return s.logger.With(fields...)
+}
+
+// Wraps the argument with the current span context, if the
+// invocation is traced and the target can unwrap the envelope.
+func (s *statefunContext) traced(target *protocol.Address, argument *protocol.TypedValue) *protocol.TypedValue {
+	if !s.spanContext.IsValid() || !s.traceTargets[target.Namespace+"/"+target.Type] {
+		return argument
+	}
+
+	traced, err := wrapTraced(s.spanContext, argument)
+	if err != nil {
+		panic(err)
+	}
+
+	return traced
+}
+
 func (s *statefunContext) Send(message MessageBuilder) {
 	msg, err := message.ToMessage()
 
@@ -67,7 +138,7 @@ func (s *statefunContext) Send(message MessageBuilder) {
 
 	invocation := &protocol.FromFunction_Invocation{
 		Target:   msg.target,
-		Argument: msg.typedValue,
+		Argument: s.traced(msg.target, msg.typedValue),
 	}
 
 	s.Lock()
@@ -84,7 +155,7 @@ func (s *statefunContext) SendAfter(delay time.Duration, message MessageBuilder)
 
 	invocation := &protocol.FromFunction_DelayedInvocation{
 		Target:    msg.target,
-		Argument:  msg.typedValue,
+		Argument:  s.traced(msg.target, msg.typedValue),
 		DelayInMs: delay.Milliseconds(),
 	}
 
@@ -100,6 +171,11 @@ func (s *statefunContext) SendEgress(egress EgressBuilder) {
 		panic(err)
 	}
 
+	if s.tracer != nil {
+		_, span := s.tracer.Start(s.Context, "egress "+msg.EgressNamespace+"/"+msg.EgressType, s.spanContext)
+		span.End()
+	}
+
 	s.Lock()
 	s.response.OutgoingEgresses = append(s.response.OutgoingEgresses, msg)
 	s.Unlock()
@@ -0,0 +1,83 @@
+package statefun
+
+// A DeadLetter describes an invocation that
+// failed with a PermanentError.
+type DeadLetter struct {
+	// The Address of the function instance
+	// that failed to process the message.
+	Target Address
+
+	// The caller function instance's Address, if applicable.
+	// This is nil if the message was sent via an ingress.
+	Caller *Address
+
+	// The message that could not be processed.
+	Message Message
+
+	// The error returned by the function.
+	Err error
+}
+
+// A DeadLetterRouter converts a DeadLetter into an EgressBuilder
+// so that messages which permanently failed can be captured for
+// later inspection or replay. If the router returns nil, the
+// message is discarded.
+type DeadLetterRouter func(letter DeadLetter) EgressBuilder
+
+// The TypeName of values sent by DeadLetterEgress.
+var DeadLetterType = MakeJsonType(TypeNameFrom("io.statefun.sdk.go/DeadLetter"))
+
+type deadLetterAddress struct {
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+}
+
+type deadLetterRecord struct {
+	Target        deadLetterAddress  `json:"target"`
+	Caller        *deadLetterAddress `json:"caller,omitempty"`
+	ValueTypeName string             `json:"value_type_name"`
+	Value         []byte             `json:"value"`
+	Error         string             `json:"error"`
+}
+
+// Returns a DeadLetterRouter that sends every DeadLetter to the
+// generic egress with the given TypeName. Values are encoded as
+// JSON with the TypeName of DeadLetterType, in the form:
+//
+//	{
+//	  "target": {"namespace": "...", "type": "...", "id": "..."},
+//	  "caller": {"namespace": "...", "type": "...", "id": "..."},
+//	  "value_type_name": "...",
+//	  "value": "<base64 encoded message value>",
+//	  "error": "..."
+//	}
+func DeadLetterEgress(target TypeName) DeadLetterRouter {
+	return func(letter DeadLetter) EgressBuilder {
+		record := deadLetterRecord{
+			Target:        toDeadLetterAddress(letter.Target),
+			ValueTypeName: letter.Message.ValueTypeName().String(),
+			Value:         letter.Message.RawValue(),
+			Error:         letter.Err.Error(),
+		}
+
+		if letter.Caller != nil {
+			caller := toDeadLetterAddress(*letter.Caller)
+			record.Caller = &caller
+		}
+
+		return GenericEgressBuilder{
+			Target:    target,
+			Value:     record,
+			ValueType: DeadLetterType,
+		}
+	}
+}
+
+func toDeadLetterAddress(address Address) deadLetterAddress {
+	return deadLetterAddress{
+		Namespace: address.FunctionType.GetNamespace(),
+		Type:      address.FunctionType.GetType(),
+		Id:        address.Id,
+	}
+}
@@ -20,6 +20,9 @@ type EgressBuilder interface {
 //   - []bytes
 //   - an int (as defined by Kafka's serialization format)
 //   - float (as defined by Kafka's serialization format)
+//
+// To produce Avro records in the Confluent wire format, use a ValueType
+// created by MakeAvroType with the WithSchemaRegistry option.
 type KafkaEgressBuilder struct {
 	// The TypeName as specified in module.yaml
 	Target TypeName
@@ -59,7 +62,7 @@ func (k KafkaEgressBuilder) toEgressMessage() (*protocol.FromFunction_EgressMess
 	} else {
 		switch value := k.Value.(type) {
 		case string:
-			_ = StringType.Serialize(&buffer, value)
+			buffer.WriteString(value)
 		case []byte:
 			buffer.Write(value)
 		case int, int32, int64, float32, float64:
@@ -138,7 +141,7 @@ func (k KinesisEgressBuilder) toEgressMessage() (*protocol.FromFunction_EgressMe
 	} else {
 		switch value := k.Value.(type) {
 		case string:
-			_ = StringType.Serialize(&buffer, value)
+			buffer.WriteString(value)
 		case []byte:
 			buffer.Write(value)
 		default:
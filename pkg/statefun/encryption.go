@@ -0,0 +1,416 @@
+package statefun
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// A KeyProvider manages the key encryption keys used by Encrypted
+// types. Every value is encrypted with its own data key, which is
+// stored alongside the value after being encrypted by the provider
+// under a key encryption key. Only the id of that key is stored in
+// the value, so keys can be rotated by making a new key current
+// while keeping older keys available for decryption.
+//
+// Providers backed by a remote key management service are called
+// for every value that is read or written, and should cache keys
+// accordingly.
+type KeyProvider interface {
+	// Returns the id of the key that new data keys are encrypted with.
+	CurrentKeyID() (string, error)
+
+	// Encrypts a data key with the key of the given id.
+	WrapKey(keyID string, dataKey []byte) ([]byte, error)
+
+	// Decrypts a data key that was encrypted with the key of the given id.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// A LocalKeyProvider is a KeyProvider that holds AES key encryption
+// keys in memory. It is useful for tests and for applications that
+// load keys from a local file, see LoadLocalKeyProvider.
+type LocalKeyProvider struct {
+	mutex   sync.RWMutex
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// Creates a new LocalKeyProvider without any keys.
+func NewLocalKeyProvider() *LocalKeyProvider {
+	return &LocalKeyProvider{keys: map[string]cipher.AEAD{}}
+}
+
+// Loads a LocalKeyProvider from a JSON file of the form:
+//
+//	{
+//	  "keys": [
+//	    {"id": "2023-01", "key": "<base64 encoded 32 byte key>"},
+//	    {"id": "2023-06", "key": "<base64 encoded 32 byte key>"}
+//	  ]
+//	}
+//
+// The last key in the file is the current key.
+func LoadLocalKeyProvider(path string) (*LocalKeyProvider, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Keys []struct {
+			Id  string `json:"id"`
+			Key string `json:"key"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+
+	provider := NewLocalKeyProvider()
+	for _, key := range file.Keys {
+		decoded, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s in %s is not valid base64: %w", key.Id, path, err)
+		}
+
+		if err := provider.AddKey(key.Id, decoded); err != nil {
+			return nil, err
+		}
+	}
+
+	return provider, nil
+}
+
+// Adds an AES-128, AES-192 or AES-256 key under the given id,
+// and makes it the current key. Previously added keys remain
+// available to decrypt existing values.
+func (l *LocalKeyProvider) AddKey(keyID string, key []byte) error {
+	if keyID == "" {
+		return errors.New("key id cannot be empty")
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return fmt.Errorf("invalid key %s: %w", keyID, err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.keys[keyID] = aead
+	l.current = keyID
+	return nil
+}
+
+func (l *LocalKeyProvider) CurrentKeyID() (string, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.current == "" {
+		return "", errors.New("no key has been added")
+	}
+
+	return l.current, nil
+}
+
+func (l *LocalKeyProvider) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := l.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealGCM(aead, dataKey, []byte(keyID))
+}
+
+func (l *LocalKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := l.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return openGCM(aead, wrapped, []byte(keyID))
+}
+
+func (l *LocalKeyProvider) key(keyID string) (cipher.AEAD, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	aead, exists := l.keys[keyID]
+	if !exists {
+		return nil, fmt.Errorf("unknown key %s", keyID)
+	}
+
+	return aead, nil
+}
+
+// The marker that prefixes every value written by an encrypted type.
+var encryptionMarker = [2]byte{0xFE, 0x45}
+
+const (
+	encryptionVersion = 1
+	dataKeySize       = 32
+)
+
+// An EncryptionOption configures a SimpleType created by Encrypted.
+type EncryptionOption func(*encryptedType)
+
+// Reads values that have no encryption header as plaintext, so that
+// encryption can be enabled for existing state. Values are encrypted
+// as they are rewritten. By default, such values fail to deserialize.
+func WithPlaintextReads() EncryptionOption {
+	return func(e *encryptedType) {
+		e.plaintextReads = true
+	}
+}
+
+type encryptedType struct {
+	inner          SimpleType
+	provider       KeyProvider
+	plaintextReads bool
+}
+
+// Wraps a SimpleType to encrypt its values using envelope encryption,
+// for values holding sensitive data that must not be stored in
+// plaintext, such as in Flink checkpoints or on an egress topic.
+//
+//	var PersonType = statefun.Encrypted(statefun.MakeJsonType(PersonTypeName), keys)
+//
+// Each value is encrypted with AES-256-GCM using a new random data
+// key, which is encrypted by the KeyProvider and written to the
+// value's header along with the id of the key that encrypted it.
+// The type may be used anywhere a SimpleType is accepted, including
+// the ValueType of a ValueSpec, MessageBuilder, and the egress
+// builders.
+//
+// The type keeps the TypeName of the wrapped type. A wrapped
+// VersionedType upgrades persisted state as usual, and the upgraded
+// value is written back encrypted. To compress
+// encrypted values, wrap a Compressed type, as encrypted data
+// cannot be compressed.
+func Encrypted(inner SimpleType, provider KeyProvider, options ...EncryptionOption) SimpleType {
+	e := &encryptedType{
+		inner:    inner,
+		provider: provider,
+	}
+
+	for _, option := range options {
+		option(e)
+	}
+
+	return e
+}
+
+func (e *encryptedType) GetTypeName() TypeName {
+	return e.inner.GetTypeName()
+}
+
+func (e *encryptedType) Deserialize(r io.Reader, receiver interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := e.decrypt(data)
+	if err != nil {
+		return err
+	}
+
+	return e.inner.Deserialize(bytes.NewReader(plaintext), receiver)
+}
+
+func (e *encryptedType) Serialize(writer io.Writer, data interface{}) error {
+	buffer := bytes.Buffer{}
+	if err := e.inner.Serialize(&buffer, data); err != nil {
+		return err
+	}
+
+	return e.encrypt(writer, buffer.Bytes())
+}
+
+// Returns the plaintext of a value, or the value as
+// is if it has no header and plaintext reads are allowed.
+func (e *encryptedType) decrypt(data []byte) ([]byte, error) {
+	if len(data) < len(encryptionMarker) || data[0] != encryptionMarker[0] || data[1] != encryptionMarker[1] {
+		if !e.plaintextReads {
+			return nil, fmt.Errorf("value of type %s is not encrypted", e.inner.GetTypeName())
+		}
+
+		return data, nil
+	}
+
+	keyID, wrapped, header, err := readEncryptionHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := e.provider.UnwrapKey(keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key with key %s: %w", keyID, err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := openGCM(aead, data[len(header):], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value of type %s: %w", e.inner.GetTypeName(), err)
+	}
+
+	return plaintext, nil
+}
+
+// Writes the plaintext encrypted with a new data key.
+func (e *encryptedType) encrypt(writer io.Writer, plaintext []byte) error {
+	keyID, err := e.provider.CurrentKeyID()
+	if err != nil {
+		return fmt.Errorf("failed to get current key: %w", err)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+
+	wrapped, err := e.provider.WrapKey(keyID, dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data key with key %s: %w", keyID, err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	// the header is authenticated, so the key id and
+	// data key cannot be swapped for those of another value
+	header := encryptionHeader(keyID, wrapped)
+	ciphertext, err := sealGCM(aead, plaintext, header)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	_, err = writer.Write(ciphertext)
+	return err
+}
+
+// Upgrades a persisted value of the wrapped type, such as a
+// VersionedType, by decrypting it and encrypting the upgraded
+// value. It returns nil if the value is already current.
+func (e *encryptedType) upgrade(typeName string, data []byte) ([]byte, error) {
+	upgradable, ok := e.inner.(upgradableType)
+	if !ok {
+		return nil, nil
+	}
+
+	plaintext, err := e.decrypt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	upgraded, err := upgradable.upgrade(typeName, plaintext)
+	if err != nil || upgraded == nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := e.encrypt(&buffer, upgraded); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Returns true if the wrapped type is able
+// to read values of the given TypeName.
+func (e *encryptedType) matchesTypeName(typeName string) bool {
+	matcher, ok := e.inner.(typeNameMatcher)
+	return ok && matcher.matchesTypeName(typeName)
+}
+
+// Encodes the header of an encrypted value:
+//
+//	marker | version | uvarint len | key id | uvarint len | wrapped data key
+func encryptionHeader(keyID string, wrapped []byte) []byte {
+	header := append([]byte(nil), encryptionMarker[:]...)
+	header = append(header, encryptionVersion)
+	header = binary.AppendUvarint(header, uint64(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.AppendUvarint(header, uint64(len(wrapped)))
+	return append(header, wrapped...)
+}
+
+// Splits an encrypted value into its key id,
+// wrapped data key, and the complete header.
+func readEncryptionHeader(data []byte) (string, []byte, []byte, error) {
+	malformed := errors.New("malformed encryption header")
+
+	offset := len(encryptionMarker)
+	if len(data) <= offset {
+		return "", nil, nil, malformed
+	}
+
+	if version := data[offset]; version != encryptionVersion {
+		return "", nil, nil, fmt.Errorf("unsupported encryption version %d", version)
+	}
+	offset++
+
+	fields := make([][]byte, 2)
+	for i := range fields {
+		length, n := binary.Uvarint(data[offset:])
+		if n <= 0 || uint64(len(data)-offset-n) < length {
+			return "", nil, nil, malformed
+		}
+
+		offset += n
+		fields[i] = data[offset : offset+int(length)]
+		offset += int(length)
+	}
+
+	return string(fields[0]), fields[1], data[:offset], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypts the plaintext with a random nonce,
+// which prefixes the returned ciphertext.
+func sealGCM(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openGCM(aead cipher.AEAD, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additionalData)
+}
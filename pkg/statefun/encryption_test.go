@@ -0,0 +1,188 @@
+package statefun
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"testing"
+)
+
+type Person struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+var (
+	personTypeName = TypeNameFrom("org.foo/Person")
+	alice          = Person{Name: "alice", Email: "alice@example.com"}
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEncryptedType(t *testing.T) {
+	keys := NewLocalKeyProvider()
+	assert.NoError(t, keys.AddKey("k1", testKey(1)))
+
+	encrypted := Encrypted(MakeJsonType(personTypeName), keys)
+	assert.Equal(t, personTypeName, encrypted.GetTypeName())
+
+	buffer := bytes.Buffer{}
+	err := encrypted.Serialize(&buffer, alice)
+	assert.NoError(t, err)
+	assert.NotContains(t, buffer.String(), alice.Email, "values should not be stored in plaintext")
+
+	var result Person
+	err = encrypted.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, result)
+
+	other := bytes.Buffer{}
+	_ = encrypted.Serialize(&other, alice)
+	assert.NotEqual(t, buffer.Bytes(), other.Bytes(), "every value should use a new data key")
+}
+
+func TestEncryptedTypeKeyRotation(t *testing.T) {
+	keys := NewLocalKeyProvider()
+	assert.NoError(t, keys.AddKey("k1", testKey(1)))
+	encrypted := Encrypted(MakeJsonType(personTypeName), keys)
+
+	old := bytes.Buffer{}
+	assert.NoError(t, encrypted.Serialize(&old, alice))
+
+	assert.NoError(t, keys.AddKey("k2", testKey(2)))
+	current := bytes.Buffer{}
+	assert.NoError(t, encrypted.Serialize(&current, alice))
+
+	keyID, _, _, err := readEncryptionHeader(current.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", keyID, "new values should use the current key")
+
+	var result Person
+	assert.NoError(t, encrypted.Deserialize(bytes.NewReader(old.Bytes()), &result), "values encrypted with older keys should be readable")
+	assert.Equal(t, alice, result)
+
+	retired := Encrypted(MakeJsonType(personTypeName), NewLocalKeyProvider())
+	assert.Error(t, retired.Deserialize(bytes.NewReader(old.Bytes()), &result), "values cannot be read without their key")
+}
+
+func TestEncryptedTypeDetectsTampering(t *testing.T) {
+	keys := NewLocalKeyProvider()
+	assert.NoError(t, keys.AddKey("k1", testKey(1)))
+	encrypted := Encrypted(MakeJsonType(personTypeName), keys)
+
+	buffer := bytes.Buffer{}
+	assert.NoError(t, encrypted.Serialize(&buffer, alice))
+
+	data := buffer.Bytes()
+	data[len(data)-1] ^= 0xFF
+
+	var result Person
+	assert.Error(t, encrypted.Deserialize(bytes.NewReader(data), &result))
+}
+
+func TestEncryptedTypePlaintextReads(t *testing.T) {
+	keys := NewLocalKeyProvider()
+	assert.NoError(t, keys.AddKey("k1", testKey(1)))
+
+	plaintext := bytes.Buffer{}
+	assert.NoError(t, MakeJsonType(personTypeName).Serialize(&plaintext, alice))
+
+	var result Person
+	err := Encrypted(MakeJsonType(personTypeName), keys).Deserialize(bytes.NewReader(plaintext.Bytes()), &result)
+	assert.Error(t, err, "unencrypted values should be rejected by default")
+
+	err = Encrypted(MakeJsonType(personTypeName), keys, WithPlaintextReads()).Deserialize(bytes.NewReader(plaintext.Bytes()), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, result)
+}
+
+func TestEncryptedPayloads(t *testing.T) {
+	keys := NewLocalKeyProvider()
+	assert.NoError(t, keys.AddKey("k1", testKey(1)))
+	encrypted := Encrypted(MakeJsonType(personTypeName), keys)
+
+	message, err := MessageBuilder{
+		Target:    Address{FunctionType: TypeNameFrom("org.foo/bar"), Id: "a"},
+		Value:     alice,
+		ValueType: encrypted,
+	}.ToMessage()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(message.RawValue()), alice.Email)
+
+	received, err := As[Person](message, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, received)
+
+	egress, err := GenericEgressBuilder{
+		Target:    TypeNameFrom("org.foo/egress"),
+		Value:     alice,
+		ValueType: encrypted,
+	}.toEgressMessage()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(egress.Argument.Value), alice.Email)
+
+	spec := ValueSpec{Name: "person", ValueType: encrypted}
+	storage, err := storageWithValue(spec, personTypeName.String(), nil)
+	assert.NoError(t, err)
+
+	storage.Set(spec, alice)
+	mutations := storage.getStateMutations()
+	assert.Len(t, mutations, 1)
+	assert.Equal(t, protocol.FromFunction_PersistedValueMutation_MODIFY, mutations[0].MutationType)
+	assert.NotContains(t, string(mutations[0].StateValue.Value), alice.Email, "state should not be checkpointed in plaintext")
+
+	var stored Person
+	assert.True(t, storage.Get(spec, &stored))
+	assert.Equal(t, alice, stored)
+}
+
+func TestLoadLocalKeyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	contents := fmt.Sprintf(`{"keys": [{"id": "k1", "key": %q}, {"id": "k2", "key": %q}]}`,
+		base64.StdEncoding.EncodeToString(testKey(1)),
+		base64.StdEncoding.EncodeToString(testKey(2)))
+	assert.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+
+	keys, err := LoadLocalKeyProvider(path)
+	assert.NoError(t, err)
+
+	current, err := keys.CurrentKeyID()
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", current, "the last key should be current")
+
+	_, err = keys.UnwrapKey("k1", []byte("garbage"))
+	assert.Error(t, err)
+}
+
+func TestEncryptedVersionedStateUpgrade(t *testing.T) {
+	keys := NewLocalKeyProvider()
+	assert.NoError(t, keys.AddKey("k1", testKey(1)))
+
+	spec := ValueSpec{Name: "user", ValueType: Encrypted(versionedUserType(), keys)}
+
+	legacy := bytes.Buffer{}
+	err := Encrypted(MakeJsonType(TypeNameFrom("org.foo/User")), keys).Serialize(&legacy, User{"bob", "mop"})
+	assert.NoError(t, err)
+
+	storage := versionedStorage(t, spec, "org.foo/User", legacy.Bytes())
+
+	var user userV2
+	assert.True(t, storage.Get(spec, &user))
+	assert.Equal(t, userV2{Name: "bob mop", Visits: 1}, user)
+
+	mutations := storage.getStateMutations()
+	assert.Len(t, mutations, 1, "upgraded state should be written back")
+	assert.Equal(t, "org.foo/User@v2", mutations[0].StateValue.Typename)
+	assert.NotContains(t, string(mutations[0].StateValue.Value), "bob", "upgraded state should be encrypted")
+
+	var written userV2
+	err = spec.ValueType.Deserialize(bytes.NewReader(mutations[0].StateValue.Value), &written)
+	assert.NoError(t, err)
+	assert.Equal(t, user, written)
+}
@@ -0,0 +1,112 @@
+package statefun
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A RetryableError signals that an invocation failed due to a
+// transient condition, such as an unavailable downstream service,
+// and should be reattempted. The RequestReplyHandler fails the
+// entire batch so that the runtime redelivers it. This is also
+// the behavior for any error that is not a PermanentError.
+type RetryableError struct {
+	Err error
+}
+
+// Wraps err as a RetryableError.
+func Retryable(err error) error {
+	return RetryableError{Err: err}
+}
+
+func (r RetryableError) Error() string {
+	return fmt.Sprintf("retryable failure: %v", r.Err)
+}
+
+func (r RetryableError) Unwrap() error {
+	return r.Err
+}
+
+// A PermanentError signals that an invocation failed in a way that
+// cannot succeed if reattempted, such as a malformed message.
+//
+// Instead of failing the batch, the RequestReplyHandler discards
+// the failed invocation, along with any messages it sent and state
+// it modified, and continues with the remainder of the batch. If a
+// DeadLetterRouter is configured, the failed message is sent to the
+// egress it returns.
+type PermanentError struct {
+	Err error
+}
+
+// Wraps err as a PermanentError.
+func Permanent(err error) error {
+	return PermanentError{Err: err}
+}
+
+func (p PermanentError) Error() string {
+	return fmt.Sprintf("permanent failure: %v", p.Err)
+}
+
+func (p PermanentError) Unwrap() error {
+	return p.Err
+}
+
+// A PanicError is returned when a StatefulFunction panics
+// during an invocation. Panics are treated like any other
+// failed invocation, so the batch will be reattempted.
+type PanicError struct {
+	// The value passed to panic.
+	Value interface{}
+
+	// The stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (p PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Returns the value passed to panic, if it is an error.
+func (p PanicError) Unwrap() error {
+	if err, ok := p.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// A PanicHandler is called with the Address of the function
+// instance and the recovered PanicError whenever a
+// StatefulFunction panics. It may be used to report
+// panics to an external error tracker.
+type PanicHandler func(self Address, err PanicError)
+
+// A TimeoutError is returned when an invocation exceeds the
+// Timeout of its StatefulFunctionSpec, or the invocation batch
+// exceeds the batch timeout of the StatefulFunctions registry.
+// Like a RetryableError, it fails the entire batch so that the
+// runtime redelivers it.
+type TimeoutError struct {
+	// The timeout that was exceeded.
+	Timeout time.Duration
+
+	// Whether the batch timeout was exceeded,
+	// rather than the function's Timeout.
+	Batch bool
+}
+
+func (t TimeoutError) Error() string {
+	if t.Batch {
+		return fmt.Sprintf("invocation batch timed out after %s", t.Timeout)
+	}
+
+	return fmt.Sprintf("invocation timed out after %s", t.Timeout)
+}
+
+// Returns context.DeadlineExceeded, so that
+// errors.Is(err, context.DeadlineExceeded) holds.
+func (t TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
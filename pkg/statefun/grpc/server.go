@@ -0,0 +1,232 @@
+// Package grpc serves a statefun.RequestReplyHandler over gRPC, as an
+// alternative to HTTP/1.1 POST requests, so that the connection to the
+// functions is multiplexed over HTTP/2. The ToFunction request and the
+// FromFunction response are exchanged through a unary RPC, declared in
+// the io.statefun.sdk.reqreply package of request-reply.proto as:
+//
+//	service RequestReply {
+//		rpc Invoke(ToFunction) returns (FromFunction);
+//	}
+//
+// A server is created from the registered functions, and optionally
+// secured with TLS and configured with keepalives:
+//
+//	server := statefungrpc.NewServer(functions.AsHandler(),
+//		statefungrpc.WithTLS(tlsConfig),
+//		statefungrpc.WithKeepalive(keepalive.ServerParameters{Time: time.Minute}))
+//
+//	listener, _ := net.Listen("tcp", ":8000")
+//	server.Serve(listener)
+//
+// The service can also be added to an existing server with Register.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"statefun-sdk-go/pkg/statefun"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+)
+
+const (
+	// The fully qualified name of the gRPC service.
+	ServiceName = "io.statefun.sdk.reqreply.RequestReply"
+
+	// The full method name of the Invoke RPC, used by clients.
+	InvokeMethod = "/" + ServiceName + "/Invoke"
+)
+
+// Implemented by the handler created by StatefulFunctions.AsHandler,
+// which dispatches the decoded request without encoding it again.
+type dispatcher interface {
+	Dispatch(ctx context.Context, toFunction *protocol.ToFunction) (*protocol.FromFunction, error)
+}
+
+// Implemented by the handler created by StatefulFunctions.AsHandler,
+// which reports the limit set with WithMaxRequestSize.
+type requestSizeLimiter interface {
+	MaxRequestSize() int64
+}
+
+type requestReplyServer interface {
+	invoke(ctx context.Context, toFunction *protocol.ToFunction) (*protocol.FromFunction, error)
+}
+
+type server struct {
+	dispatch func(ctx context.Context, toFunction *protocol.ToFunction) (*protocol.FromFunction, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*requestReplyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Invoke",
+			Handler:    invokeHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "request-reply.proto",
+}
+
+// Registers the RequestReply service, backed by the handler,
+// with an existing gRPC server. The maximum request size is that
+// of the server, not the handler's WithMaxRequestSize option.
+func Register(registrar grpc.ServiceRegistrar, handler statefun.RequestReplyHandler) {
+	registrar.RegisterService(&serviceDesc, newServer(handler))
+}
+
+// Creates a gRPC server that serves the handler's functions.
+//
+// The server accepts requests up to the size set with the handler's
+// WithMaxRequestSize option. If the handler does not limit the size,
+// the gRPC default of 4 MiB applies; larger requests are rejected
+// with ResourceExhausted. A different limit may be set with
+// WithServerOptions and grpc.MaxRecvMsgSize.
+func NewServer(handler statefun.RequestReplyHandler, options ...Option) *grpc.Server {
+	config := serverConfig{}
+	if limiter, ok := handler.(requestSizeLimiter); ok && limiter.MaxRequestSize() > 0 {
+		config.maxRecvMsgSize = int(limiter.MaxRequestSize())
+	}
+
+	for _, option := range options {
+		option(&config)
+	}
+
+	grpcServer := grpc.NewServer(config.serverOptions()...)
+	Register(grpcServer, handler)
+	return grpcServer
+}
+
+func newServer(handler statefun.RequestReplyHandler) *server {
+	if d, ok := handler.(dispatcher); ok {
+		return &server{dispatch: d.Dispatch}
+	}
+
+	// other implementations only accept the encoded request
+	return &server{
+		dispatch: func(ctx context.Context, toFunction *protocol.ToFunction) (*protocol.FromFunction, error) {
+			payload, err := proto.Marshal(toFunction)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal ToFunction: %w", err)
+			}
+
+			response, err := handler.Invoke(ctx, payload)
+			if err != nil {
+				return nil, err
+			}
+
+			fromFunction := &protocol.FromFunction{}
+			if err := proto.Unmarshal(response, fromFunction); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal FromFunction: %w", err)
+			}
+			return fromFunction, nil
+		},
+	}
+}
+
+func (s *server) invoke(ctx context.Context, toFunction *protocol.ToFunction) (*protocol.FromFunction, error) {
+	fromFunction, err := s.dispatch(ctx, toFunction)
+	if err == nil {
+		return fromFunction, nil
+	}
+
+	if ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	return nil, status.Error(codes.Internal, err.Error())
+}
+
+func invokeHandler(srv interface{}, ctx context.Context, decode func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	toFunction := &protocol.ToFunction{}
+	if err := decode(toFunction); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(requestReplyServer).invoke(ctx, toFunction)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InvokeMethod,
+	}
+
+	return interceptor(ctx, toFunction, info, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return srv.(requestReplyServer).invoke(ctx, request.(*protocol.ToFunction))
+	})
+}
+
+// An Option configures the server created by NewServer.
+type Option func(*serverConfig)
+
+type serverConfig struct {
+	tls            *tls.Config
+	keepalive      *keepalive.ServerParameters
+	enforcement    *keepalive.EnforcementPolicy
+	maxRecvMsgSize int
+	options        []grpc.ServerOption
+}
+
+// Serves TLS connections with the given configuration, instead of
+// plaintext HTTP/2 connections. A ClientCAs pool and ClientAuth
+// setting enable mutual TLS.
+func WithTLS(config *tls.Config) Option {
+	return func(c *serverConfig) {
+		c.tls = config
+	}
+}
+
+// Sets the keepalive parameters of the server, such as the interval
+// at which idle connections are pinged and the maximum age of a
+// connection. By default, the gRPC defaults apply.
+func WithKeepalive(parameters keepalive.ServerParameters) Option {
+	return func(c *serverConfig) {
+		c.keepalive = &parameters
+	}
+}
+
+// Sets the keepalive policy enforced on clients. Clients that ping
+// more often than the policy allows have their connection closed.
+func WithKeepaliveEnforcement(policy keepalive.EnforcementPolicy) Option {
+	return func(c *serverConfig) {
+		c.enforcement = &policy
+	}
+}
+
+// Adds arbitrary options to the gRPC server, such
+// as interceptors or message size limits.
+func WithServerOptions(options ...grpc.ServerOption) Option {
+	return func(c *serverConfig) {
+		c.options = append(c.options, options...)
+	}
+}
+
+func (c *serverConfig) serverOptions() []grpc.ServerOption {
+	var options []grpc.ServerOption
+	if c.tls != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(c.tls)))
+	}
+
+	if c.keepalive != nil {
+		options = append(options, grpc.KeepaliveParams(*c.keepalive))
+	}
+
+	if c.enforcement != nil {
+		options = append(options, grpc.KeepaliveEnforcementPolicy(*c.enforcement))
+	}
+
+	if c.maxRecvMsgSize > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(c.maxRecvMsgSize))
+	}
+
+	return append(options, c.options...)
+}
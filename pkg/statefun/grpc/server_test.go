@@ -0,0 +1,224 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"math/big"
+	"net"
+	"statefun-sdk-go/pkg/statefun"
+	"statefun-sdk-go/pkg/statefun/internal/greeter"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"testing"
+	"time"
+)
+
+func testHandler() statefun.RequestReplyHandler {
+	return greeter.Functions().AsHandler()
+}
+
+func toFunction(t *testing.T, functionType string) *protocol.ToFunction {
+	argument := statefun.MessageBuilder{
+		Target: statefun.Address{FunctionType: statefun.TypeNameFrom(functionType), Id: "bob"},
+		Value:  "bob",
+	}
+
+	value, err := argument.ToMessage()
+	assert.NoError(t, err)
+
+	typeName := statefun.TypeNameFrom(functionType)
+	return &protocol.ToFunction{
+		Request: &protocol.ToFunction_Invocation_{
+			Invocation: &protocol.ToFunction_InvocationBatchRequest{
+				Target: &protocol.Address{
+					Namespace: typeName.GetNamespace(),
+					Type:      typeName.GetType(),
+					Id:        "bob",
+				},
+				State: []*protocol.ToFunction_PersistedValue{
+					{
+						StateName:  "seen",
+						StateValue: &protocol.TypedValue{Typename: "io.statefun.types/int", HasValue: false},
+					},
+				},
+				Invocations: []*protocol.ToFunction_Invocation{
+					{
+						Argument: &protocol.TypedValue{
+							Typename: value.ValueTypeName().String(),
+							HasValue: true,
+							Value:    value.RawValue(),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Starts the server on an in-memory listener and returns a
+// connection to it, which is closed at the end of the test.
+func serve(t *testing.T, server *grpc.Server, options ...grpc.DialOption) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	options = append(options, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+
+	conn, err := grpc.Dial("bufnet", options...)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return conn
+}
+
+func assertInvoked(t *testing.T, conn *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var from protocol.FromFunction
+	err := conn.Invoke(ctx, InvokeMethod, toFunction(t, "org.foo/greeter"), &from)
+	assert.NoError(t, err)
+
+	result := from.GetInvocationResult()
+	assert.NotNil(t, result, "invocation result should not be nil")
+
+	assert.Equal(t, "seen", result.StateMutations[0].StateName)
+	assert.Equal(t, []byte{0x0d, 0x01, 0x00, 0x00, 0x00}, result.StateMutations[0].StateValue.Value)
+	assert.Equal(t, &protocol.Address{
+		Namespace: "org.foo",
+		Type:      "inbox",
+		Id:        "bob",
+	}, result.OutgoingMessages[0].Target)
+}
+
+func TestInvoke(t *testing.T) {
+	server := NewServer(testHandler(), WithKeepalive(keepalive.ServerParameters{
+		Time:    time.Minute,
+		Timeout: 10 * time.Second,
+	}))
+
+	conn := serve(t, server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertInvoked(t, conn)
+}
+
+// hides the Dispatch method of the handler,
+// like a user provided RequestReplyHandler
+type wrappedHandler struct {
+	statefun.RequestReplyHandler
+}
+
+func TestInvokeEncodedHandler(t *testing.T) {
+	server := NewServer(wrappedHandler{testHandler()})
+
+	conn := serve(t, server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertInvoked(t, conn)
+}
+
+func TestRegister(t *testing.T) {
+	server := grpc.NewServer()
+	Register(server, testHandler())
+
+	assert.Contains(t, server.GetServiceInfo(), ServiceName)
+
+	conn := serve(t, server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertInvoked(t, conn)
+}
+
+func TestInvokeError(t *testing.T) {
+	server := NewServer(testHandler())
+	conn := serve(t, server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	var from protocol.FromFunction
+	err := conn.Invoke(context.Background(), InvokeMethod, toFunction(t, "org.foo/unknown"), &from)
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "unknown function type org.foo/unknown")
+}
+
+func TestInterceptor(t *testing.T) {
+	var method string
+	server := NewServer(testHandler(), WithServerOptions(grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			method = info.FullMethod
+			return handler(ctx, req)
+		})))
+
+	conn := serve(t, server, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertInvoked(t, conn)
+	assert.Equal(t, InvokeMethod, method)
+}
+
+func TestTLS(t *testing.T) {
+	certificate, pool := selfSignedCertificate(t)
+
+	server := NewServer(testHandler(), WithTLS(&tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	}))
+
+	conn := serve(t, server, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		RootCAs:    pool,
+		ServerName: "localhost",
+	})))
+
+	assertInvoked(t, conn)
+}
+
+func selfSignedCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	functions := greeter.Functions()
+	functions.WithMaxRequestSize(16)
+
+	conn := serve(t, NewServer(functions.AsHandler()), grpc.WithTransportCredentials(insecure.NewCredentials()))
+
+	var from protocol.FromFunction
+	err := conn.Invoke(context.Background(), InvokeMethod, toFunction(t, "org.foo/greeter"), &from)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "requests larger than the handler's limit should be rejected")
+
+	// options given to the server take precedence
+	conn = serve(t, NewServer(functions.AsHandler(), WithServerOptions(grpc.MaxRecvMsgSize(1<<20))),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertInvoked(t, conn)
+}
@@ -3,11 +3,17 @@ package statefun
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"google.golang.org/protobuf/proto"
-	"log"
+	"io"
 	"net/http"
+	"runtime/debug"
+	"sort"
 	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // A registry for multiple StatefulFunction's. A RequestReplyHandler
@@ -21,6 +27,57 @@ type StatefulFunctions interface {
 	// used to build the runtime function.
 	WithSpec(spec StatefulFunctionSpec) error
 
+	// Registers a DeadLetterRouter, which is used to send
+	// messages that failed with a PermanentError to an egress.
+	// By default such messages are discarded.
+	WithDeadLetters(router DeadLetterRouter)
+
+	// Registers a PanicHandler, which is called whenever
+	// a StatefulFunction panics during an invocation.
+	WithPanicHandler(handler PanicHandler)
+
+	// Sets the Metrics that receive measurements from the
+	// handler. By default, no metrics are recorded.
+	WithMetrics(metrics Metrics)
+
+	// Registers a Tracer, which starts a span for every
+	// invocation and propagates it to downstream functions
+	// registered with this builder. By default, invocations
+	// are not traced.
+	WithTracer(tracer Tracer)
+
+	// Propagates the span context of traced invocations to
+	// function types that are served by a different handler,
+	// which must also use this SDK with a registered Tracer.
+	// Messages sent to any other function type are not traced.
+	WithTracePropagation(functionTypes ...TypeName)
+
+	// Registers Interceptor's that are applied to every
+	// invocation of every function, in the order given.
+	WithInterceptors(interceptors ...Interceptor)
+
+	// Sets the Logger used by the handler and passed to
+	// functions through Context. By default, events at
+	// InfoLevel and above are written to standard error.
+	WithLogger(logger Logger)
+
+	// Sets the maximum size, in bytes, of a request body accepted
+	// by the handler's ServeHTTP method. Larger requests are
+	// rejected with 413 Request Entity Too Large before they are
+	// fully read. The gRPC server created by statefun/grpc applies
+	// the same limit. By default, the request size is not limited.
+	WithMaxRequestSize(size int64)
+
+	// Sets a bound on the duration of each invocation batch,
+	// which sets the Deadline of the Context of every function
+	// invoked in the batch. A batch that exceeds it fails with
+	// a TimeoutError. By default, it is not bounded.
+	WithBatchTimeout(timeout time.Duration)
+
+	// Writes the remote module specification (module.yaml),
+	// routing every registered function type to the Endpoint.
+	WriteModuleYaml(writer io.Writer, endpoint Endpoint) error
+
 	// Creates a RequestReplyHandler from the registered
 	// function specs.
 	AsHandler() RequestReplyHandler
@@ -41,14 +98,35 @@ type RequestReplyHandler interface {
 // Creates a new StatefulFunctions registry.
 func StatefulFunctionsBuilder() StatefulFunctions {
 	return &handler{
-		module:     map[TypeName]StatefulFunction{},
-		stateSpecs: map[TypeName]map[string]*protocol.FromFunction_PersistedValueSpec{},
+		module:       map[TypeName]StatefulFunction{},
+		functions:    map[TypeName]StatefulFunction{},
+		interceptors: map[TypeName][]Interceptor{},
+		timeouts:     map[TypeName]time.Duration{},
+		stateSpecs:   map[TypeName]map[string]*protocol.FromFunction_PersistedValueSpec{},
+		valueSpecs:   map[TypeName]map[string]ValueSpec{},
+		traceTargets: map[string]bool{},
+		logger:       defaultLogger(),
+		metrics:      nopMetrics{},
 	}
 }
 
 type handler struct {
-	module     map[TypeName]StatefulFunction
-	stateSpecs map[TypeName]map[string]*protocol.FromFunction_PersistedValueSpec
+	module       map[TypeName]StatefulFunction
+	functions    map[TypeName]StatefulFunction
+	interceptors map[TypeName][]Interceptor
+	global       []Interceptor
+	timeouts     map[TypeName]time.Duration
+	stateSpecs   map[TypeName]map[string]*protocol.FromFunction_PersistedValueSpec
+	valueSpecs   map[TypeName]map[string]ValueSpec
+	deadLetters  DeadLetterRouter
+	panicHandler PanicHandler
+	logger       Logger
+	metrics      Metrics
+	tracer       Tracer
+	traceTargets map[string]bool
+
+	maxRequestSize int64
+	batchTimeout   time.Duration
 }
 
 func (h *handler) WithSpec(spec StatefulFunctionSpec) error {
@@ -60,8 +138,17 @@ func (h *handler) WithSpec(spec StatefulFunctionSpec) error {
 		return fmt.Errorf("failed to register Stateful Function %s, the Function instance cannot be nil", spec.FunctionType)
 	}
 
-	h.module[spec.FunctionType] = spec.Function
+	if spec.Timeout < 0 {
+		return fmt.Errorf("failed to register Stateful Function %s, the Timeout cannot be negative", spec.FunctionType)
+	}
+
+	h.functions[spec.FunctionType] = spec.Function
+	h.interceptors[spec.FunctionType] = spec.Interceptors
+	h.chain(spec.FunctionType)
+	h.timeouts[spec.FunctionType] = spec.Timeout
+	h.traceTargets[spec.FunctionType.String()] = true
 	h.stateSpecs[spec.FunctionType] = make(map[string]*protocol.FromFunction_PersistedValueSpec, len(spec.States))
+	h.valueSpecs[spec.FunctionType] = make(map[string]ValueSpec, len(spec.States))
 
 	for _, state := range spec.States {
 		if err := validateValueSpec(state); err != nil {
@@ -85,15 +172,68 @@ func (h *handler) WithSpec(spec StatefulFunctionSpec) error {
 			ExpirationSpec: expiration,
 			TypeTypename:   state.ValueType.GetTypeName().String(),
 		}
+		h.valueSpecs[spec.FunctionType][state.Name] = state
 	}
 
 	return nil
 }
 
+func (h *handler) WithDeadLetters(router DeadLetterRouter) {
+	h.deadLetters = router
+}
+
+func (h *handler) WithPanicHandler(handler PanicHandler) {
+	h.panicHandler = handler
+}
+
+func (h *handler) WithLogger(logger Logger) {
+	h.logger = logger
+}
+
+func (h *handler) WithMetrics(metrics Metrics) {
+	h.metrics = metrics
+}
+
+func (h *handler) WithTracer(tracer Tracer) {
+	h.tracer = tracer
+}
+
+func (h *handler) WithTracePropagation(functionTypes ...TypeName) {
+	for _, functionType := range functionTypes {
+		h.traceTargets[functionType.String()] = true
+	}
+}
+
+func (h *handler) WithMaxRequestSize(size int64) {
+	h.maxRequestSize = size
+}
+
+func (h *handler) WithBatchTimeout(timeout time.Duration) {
+	h.batchTimeout = timeout
+}
+
+func (h *handler) WithInterceptors(interceptors ...Interceptor) {
+	h.global = append(h.global, interceptors...)
+	for typeName := range h.module {
+		h.chain(typeName)
+	}
+}
+
+// Wraps the registered function with its interceptors, so
+// the chain is built once instead of for every batch.
+func (h *handler) chain(typeName TypeName) {
+	h.module[typeName] = intercept(h.functions[typeName], h.global, h.interceptors[typeName])
+}
+
 func (h *handler) AsHandler() RequestReplyHandler {
-	log.Println("Create RequestReplyHandler")
 	for typeName := range h.module {
-		log.Printf("> Registering %s\n", typeName)
+		states := make([]string, 0, len(h.stateSpecs[typeName]))
+		for name := range h.stateSpecs[typeName] {
+			states = append(states, name)
+		}
+		sort.Strings(states)
+
+		h.logger.Info("registered stateful function", "function_type", typeName.String(), "states", states)
 	}
 	return h
 }
@@ -110,30 +250,74 @@ func (h *handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	if request.Body == nil || request.ContentLength == 0 {
+	// the ContentLength of chunked requests, and of requests whose
+	// body was replaced by a middleware, is unknown, so whether the
+	// body is empty is only known once it has been read
+	if request.Body == nil || request.Body == http.NoBody {
 		http.Error(writer, "empty request body", http.StatusBadRequest)
 		return
 	}
 
-	buffer := bytes.Buffer{}
-	if _, err := buffer.ReadFrom(request.Body); err != nil {
+	body := request.Body
+	if h.maxRequestSize > 0 {
+		if request.ContentLength > h.maxRequestSize {
+			http.Error(writer, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(writer, body, h.maxRequestSize)
+	}
+
+	buffer := getBuffer()
+	defer putBuffer(buffer)
+
+	if request.ContentLength > 0 {
+		buffer.Grow(int(request.ContentLength))
+	}
+
+	if _, err := buffer.ReadFrom(body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(writer, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
 		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	response, err := h.Invoke(request.Context(), buffer.Bytes())
+	if buffer.Len() == 0 {
+		http.Error(writer, "empty request body", http.StatusBadRequest)
+		return
+	}
+
+	response := responsePool.Get().(*[]byte)
+	encoded, err := h.invokeAppend(request.Context(), buffer.Bytes(), (*response)[:0])
 	if err != nil {
-		log.Printf(err.Error())
+		responsePool.Put(response)
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	_, _ = writer.Write(response)
+	writer.Header().Set("Content-Length", strconv.Itoa(len(encoded)))
+	_, _ = writer.Write(encoded)
+
+	// keep the grown slice for the next response
+	if cap(encoded) <= maxPooledBufferSize {
+		*response = encoded[:0]
+	}
+	responsePool.Put(response)
 }
 
 func (h *handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	return h.invokeAppend(ctx, payload, nil)
+}
+
+// Invokes the functions with the encoded request
+// and appends the encoded response to the buffer.
+func (h *handler) invokeAppend(ctx context.Context, payload []byte, buffer []byte) ([]byte, error) {
 	toFunction := protocol.ToFunction{}
 	if err := proto.Unmarshal(payload, &toFunction); err != nil {
+		h.logger.Error("failed to unmarshal ToFunction", "error", err)
 		return nil, fmt.Errorf("failed to unmarshal ToFunction: %w", err)
 	}
 
@@ -142,22 +326,76 @@ func (h *handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return proto.Marshal(fromFunction)
+	return proto.MarshalOptions{}.MarshalAppend(buffer, fromFunction)
+}
+
+// The largest buffer returned to the pool, so that
+// a single large request does not stay allocated.
+const maxPooledBufferSize = 4 << 20
+
+// Pools the buffers request bodies are read into, and
+// the slices responses are marshalled into.
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			return new(bytes.Buffer)
+		},
+	}
+
+	responsePool = sync.Pool{
+		New: func() interface{} {
+			return new([]byte)
+		},
+	}
+)
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buffer *bytes.Buffer) {
+	if buffer.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	buffer.Reset()
+	bufferPool.Put(buffer)
+}
+
+// Returns the maximum request size set with WithMaxRequestSize, or
+// 0 if it is not limited, so that transports such as the gRPC server
+// in statefun/grpc can apply the same limit.
+func (h *handler) MaxRequestSize() int64 {
+	return h.maxRequestSize
+}
+
+// Invokes the functions with an already decoded request. This allows
+// transports that decode requests themselves, such as the gRPC server
+// in statefun/grpc, to share the dispatch without encoding twice.
+func (h *handler) Dispatch(ctx context.Context, toFunction *protocol.ToFunction) (*protocol.FromFunction, error) {
+	return h.invoke(ctx, toFunction)
 }
 
 func (h *handler) invoke(ctx context.Context, toFunction *protocol.ToFunction) (from *protocol.FromFunction, err error) {
 	batch := toFunction.GetInvocation()
+	if batch == nil {
+		return nil, errors.New("missing invocation batch")
+	}
+
 	self := addressFromInternal(batch.Target)
 	function, exists := h.module[self.FunctionType]
 
+	start := time.Now()
+	defer func() {
+		h.logBatch(self, batch, start, from, err)
+	}()
+
 	defer func() {
 		if r := recover(); r != nil {
-			switch r := r.(type) {
-			case error:
-				err = fmt.Errorf("failed to execute invocation for %s: %w", batch.Target, r)
-			default:
-				log.Fatal(r)
-			}
+			err = fmt.Errorf("failed to execute invocation for %s: %w", batch.Target, PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			})
 		}
 	}()
 
@@ -165,9 +403,16 @@ func (h *handler) invoke(ctx context.Context, toFunction *protocol.ToFunction) (
 		return nil, fmt.Errorf("unknown function type %s", self.FunctionType)
 	}
 
-	storageFactory := newStorageFactory(batch, h.stateSpecs[self.FunctionType])
+	labels := Labels{LabelFunctionType: self.FunctionType.String()}
+	h.recordStateRead(labels, batch)
+
+	storageFactory, err := newStorageFactory(batch, h.stateSpecs[self.FunctionType], h.valueSpecs[self.FunctionType])
+	if err != nil {
+		return nil, err
+	}
 
 	if missing := storageFactory.getMissingSpecs(); missing != nil {
+		h.metrics.IncCounter(MetricIncompleteContexts, labels, 1)
 		return &protocol.FromFunction{
 			Response: &protocol.FromFunction_IncompleteInvocationContext_{
 				IncompleteInvocationContext: &protocol.FromFunction_IncompleteInvocationContext{
@@ -177,42 +422,116 @@ func (h *handler) invoke(ctx context.Context, toFunction *protocol.ToFunction) (
 		}, nil
 	}
 
+	// the request's context is kept to tell whether it
+	// or one of the handler's timeouts was exceeded
+	request := ctx
+	if h.batchTimeout > 0 {
+		var cancelBatch context.CancelFunc
+		ctx, cancelBatch = context.WithTimeout(ctx, h.batchTimeout)
+		defer cancelBatch()
+	}
+
+	timeout := h.timeouts[self.FunctionType]
+	bounded := timeout > 0 || h.batchTimeout > 0
 	storage := storageFactory.getStorage()
 	response := &protocol.FromFunction_InvocationResponse{}
+	h.metrics.Observe(MetricBatchSize, labels, float64(len(batch.Invocations)))
 
 	for _, invocation := range batch.Invocations {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, h.deadlineError(request, ctx, timeout)
 		default:
 			sContext := statefunContext{
 				self:     self,
 				storage:  storage,
 				response: response,
+				logger:   h.logger,
 			}
 
 			var cancel context.CancelFunc
-			sContext.Context, cancel = context.WithCancel(ctx)
+			if timeout > 0 {
+				sContext.Context, cancel = context.WithTimeout(ctx, timeout)
+			} else {
+				sContext.Context, cancel = context.WithCancel(ctx)
+			}
 
-			var caller Address
 			if invocation.Caller != nil {
-				caller = addressFromInternal(invocation.Caller)
+				caller := addressFromInternal(invocation.Caller)
+				sContext.caller = &caller
+			}
+
+			parent, argument, unwrapErr := unwrapTraced(invocation.Argument)
+			if unwrapErr != nil && argument == nil {
+				cancel()
+				return nil, fmt.Errorf("failed to decode message for %s: %w", self, unwrapErr)
+			} else if unwrapErr != nil {
+				// a redelivered message would carry the same traceparent,
+				// so the invocation starts a new trace instead of failing
+				h.logger.Error("discarding malformed trace context", "function_type", self.FunctionType.String(), "error", unwrapErr)
 			}
-			sContext.caller = &caller
+
 			msg := Message{
 				target:     batch.Target,
-				typedValue: invocation.Argument,
+				typedValue: argument,
+			}
+
+			var span Span
+			if h.tracer != nil {
+				sContext.Context, span = h.tracer.Start(sContext.Context, "invoke "+self.FunctionType.String(), parent)
+				sContext.Context = contextWithSpan(sContext.Context, span)
+				sContext.tracer = h.tracer
+				sContext.traceTargets = h.traceTargets
+				sContext.spanContext = span.SpanContext()
+			}
+
+			outgoing := len(response.OutgoingMessages)
+			delayed := len(response.DelayedInvocations)
+			egresses := len(response.OutgoingEgresses)
+			storage.checkpoint()
+
+			invocationStart := time.Now()
+			err = h.invokeFunction(function, &sContext, msg, labels, bounded)
+			if err != nil && sContext.Err() != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) {
+				err = fmt.Errorf("failed to execute invocation for %s: %w", self, h.deadlineError(request, ctx, timeout))
 			}
-			err = function.Invoke(&sContext, msg)
 			cancel()
 
+			if span != nil {
+				if err != nil {
+					span.RecordError(err)
+				}
+				span.End()
+			}
+
+			h.metrics.Observe(MetricInvocationLatency, labels, time.Since(invocationStart).Seconds())
+			h.metrics.IncCounter(MetricInvocations, labels, 1)
+
 			if err != nil {
-				return
+				h.metrics.IncCounter(MetricErrors, labels, 1)
+
+				var permanent PermanentError
+				if !errors.As(err, &permanent) {
+					return
+				}
+
+				// discard all side effects of the failed invocation
+				// and continue with the remainder of the batch
+				storage.rollback()
+				response.OutgoingMessages = response.OutgoingMessages[:outgoing]
+				response.DelayedInvocations = response.DelayedInvocations[:delayed]
+				response.OutgoingEgresses = response.OutgoingEgresses[:egresses]
+
+				if err = h.sendDeadLetter(response, self, sContext.caller, msg, err); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
 
 	response.StateMutations = storage.getStateMutations()
+	h.recordResponse(labels, response)
+
 	from = &protocol.FromFunction{
 		Response: &protocol.FromFunction_InvocationResult{
 			InvocationResult: response,
@@ -221,3 +540,189 @@ func (h *handler) invoke(ctx context.Context, toFunction *protocol.ToFunction) (
 
 	return
 }
+
+// Returns the error of an invocation whose context is done,
+// which is a TimeoutError if it exceeded one of the handler's
+// timeouts, rather than the deadline of the request itself.
+func (h *handler) deadlineError(request context.Context, batch context.Context, timeout time.Duration) error {
+	switch {
+	case request.Err() != nil:
+		return request.Err()
+	case batch.Err() != nil:
+		return TimeoutError{Timeout: h.batchTimeout, Batch: true}
+	default:
+		return TimeoutError{Timeout: timeout}
+	}
+}
+
+// Invokes the function, converting any panic into a PanicError.
+//
+// If the invocation is bounded by a timeout, the function is called
+// in a separate goroutine with a detached Context, whose side effects
+// are merged into the batch once it returns, so that a function that
+// does not observe its Context cannot block the batch. If the Context
+// is done first, the handler stops waiting and the goroutine is leaked
+// until the function returns; its side effects, errors and panics are
+// discarded.
+func (h *handler) invokeFunction(function StatefulFunction, ctx *statefunContext, msg Message, labels Labels, bounded bool) error {
+	var result invocationResult
+	if bounded {
+		detached := ctx.detach()
+		results := make(chan invocationResult, 1)
+		go func() {
+			results <- callFunction(function, detached, msg)
+		}()
+
+		select {
+		case result = <-results:
+		case <-ctx.Done():
+			// prefer the result of an invocation that
+			// completed at the same time
+			select {
+			case result = <-results:
+			default:
+				return ctx.Err()
+			}
+		}
+
+		if result.err == nil && result.panicked == nil {
+			ctx.merge(detached)
+		}
+	} else {
+		result = callFunction(function, ctx, msg)
+	}
+
+	if result.panicked != nil {
+		h.metrics.IncCounter(MetricPanics, labels, 1)
+		if h.panicHandler != nil {
+			h.panicHandler(ctx.self, *result.panicked)
+		}
+
+		return fmt.Errorf("failed to execute invocation for %s: %w", ctx.self, *result.panicked)
+	}
+
+	return result.err
+}
+
+type invocationResult struct {
+	err      error
+	panicked *PanicError
+}
+
+func callFunction(function StatefulFunction, ctx *statefunContext, msg Message) (result invocationResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result.panicked = &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+
+	result.err = function.Invoke(ctx, msg)
+	return
+}
+
+func (h *handler) sendDeadLetter(
+	response *protocol.FromFunction_InvocationResponse,
+	self Address,
+	caller *Address,
+	msg Message,
+	cause error,
+) error {
+	if h.deadLetters == nil {
+		h.logger.Error("discarding message after permanent failure",
+			"function_type", self.FunctionType.String(),
+			"address_id", self.Id,
+			"message_type", msg.ValueTypeName().String(),
+			"error", cause)
+		return nil
+	}
+
+	egress := h.deadLetters(DeadLetter{
+		Target:  self,
+		Caller:  caller,
+		Message: msg,
+		Err:     cause,
+	})
+
+	if egress == nil {
+		return nil
+	}
+
+	deadLetter, err := egress.toEgressMessage()
+	if err != nil {
+		return fmt.Errorf("failed to create dead letter for %s: %w", self, err)
+	}
+
+	response.OutgoingEgresses = append(response.OutgoingEgresses, deadLetter)
+	return nil
+}
+
+func (h *handler) recordStateRead(labels Labels, batch *protocol.ToFunction_InvocationBatchRequest) {
+	for _, state := range batch.State {
+		if state.StateValue == nil || !state.StateValue.HasValue {
+			continue
+		}
+
+		h.metrics.IncCounter(MetricStateBytesRead, Labels{
+			LabelFunctionType: labels[LabelFunctionType],
+			LabelState:        state.StateName,
+		}, float64(len(state.StateValue.Value)))
+	}
+}
+
+func (h *handler) recordResponse(labels Labels, response *protocol.FromFunction_InvocationResponse) {
+	h.metrics.IncCounter(MetricOutgoingMessages, labels, float64(len(response.OutgoingMessages)))
+	h.metrics.IncCounter(MetricDelayedMessages, labels, float64(len(response.DelayedInvocations)))
+	h.metrics.IncCounter(MetricEgressMessages, labels, float64(len(response.OutgoingEgresses)))
+
+	for _, mutation := range response.StateMutations {
+		if mutation.MutationType != protocol.FromFunction_PersistedValueMutation_MODIFY {
+			continue
+		}
+
+		h.metrics.IncCounter(MetricStateBytesWritten, Labels{
+			LabelFunctionType: labels[LabelFunctionType],
+			LabelState:        mutation.StateName,
+		}, float64(len(mutation.StateValue.Value)))
+	}
+}
+
+func (h *handler) logBatch(
+	self Address,
+	batch *protocol.ToFunction_InvocationBatchRequest,
+	start time.Time,
+	from *protocol.FromFunction,
+	err error,
+) {
+	states := make([]string, 0, len(batch.State))
+	for _, state := range batch.State {
+		states = append(states, state.StateName)
+	}
+
+	fields := []interface{}{
+		"function_type", self.FunctionType.String(),
+		"address_id", self.Id,
+		"batch_size", len(batch.Invocations),
+		"states", states,
+		"latency", time.Since(start),
+	}
+
+	if err != nil {
+		h.logger.Error("invocation batch failed", append(fields, "error", err)...)
+		return
+	}
+
+	if incomplete := from.GetIncompleteInvocationContext(); incomplete != nil {
+		missing := make([]string, 0, len(incomplete.MissingValues))
+		for _, spec := range incomplete.MissingValues {
+			missing = append(missing, spec.StateName)
+		}
+
+		h.logger.Debug("requesting missing state values", append(fields, "missing", missing)...)
+		return
+	}
+
+	h.logger.Debug("invocation batch completed", fields...)
+}
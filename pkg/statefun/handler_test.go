@@ -2,12 +2,21 @@ package statefun
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -239,3 +248,436 @@ func toTypedValue(valueType SimpleType, value interface{}) *protocol.TypedValue
 		Value:    buffer.Bytes(),
 	}
 }
+
+func poisonable(ctx Context, msg Message) error {
+	var seen int32
+	ctx.Storage().Get(Seen, &seen)
+	ctx.Storage().Set(Seen, seen+1)
+
+	ctx.Send(MessageBuilder{
+		Target: Address{
+			FunctionType: TypeNameFrom("org.foo/greeter-java"),
+			Id:           "0",
+		},
+		Value: msg.AsString(),
+	})
+
+	switch msg.AsString() {
+	case "poison":
+		return Permanent(errors.New("poison message"))
+	case "retry":
+		return Retryable(errors.New("try again"))
+	default:
+		return nil
+	}
+}
+
+func invokeBatch(t *testing.T, builder StatefulFunctions, arguments ...string) (*http.Response, *protocol.FromFunction) {
+	server := httptest.NewServer(builder.AsHandler())
+	defer server.Close()
+
+	response, err := http.Post(server.URL, "application/octet-stream", bytes.NewReader(encodeBatch(arguments...)))
+	assert.NoError(t, err)
+
+	var from protocol.FromFunction
+	responsebody, _ := ioutil.ReadAll(response.Body)
+	_ = proto.Unmarshal(responsebody, &from)
+
+	return response, &from
+}
+
+// Encodes a ToFunction request invoking org.foo/greeter
+// with a string message for each of the arguments.
+func encodeBatch(arguments ...string) []byte {
+	invocations := make([]*protocol.ToFunction_Invocation, 0, len(arguments))
+	for _, argument := range arguments {
+		invocations = append(invocations, &protocol.ToFunction_Invocation{
+			Argument: toTypedValue(StringType, argument),
+		})
+	}
+
+	toFunction := protocol.ToFunction{
+		Request: &protocol.ToFunction_Invocation_{
+			Invocation: &protocol.ToFunction_InvocationBatchRequest{
+				Target: &protocol.Address{
+					Namespace: "org.foo",
+					Type:      "greeter",
+					Id:        "0",
+				},
+				State: []*protocol.ToFunction_PersistedValue{
+					{
+						StateName: "seen",
+						StateValue: &protocol.TypedValue{
+							Typename: "io.statefun.types/int",
+							HasValue: false,
+						},
+					},
+				},
+				Invocations: invocations,
+			},
+		},
+	}
+
+	request, _ := proto.Marshal(&toFunction)
+	return request
+}
+
+func TestPermanentErrorDiscardsInvocation(t *testing.T) {
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function:     StatefulFunctionPointer(poisonable),
+	})
+	assert.NoError(t, err)
+
+	response, from := invokeBatch(t, builder, "hello", "poison", "world")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "received non-200 response")
+
+	result := from.GetInvocationResult()
+	assert.NotNil(t, result, "invocation result should not be nil")
+
+	var seen int32
+	assert.NoError(t, Int32Type.Deserialize(bytes.NewReader(result.StateMutations[0].StateValue.Value), &seen))
+	assert.Equal(t, int32(2), seen, "state written by the failed invocation should be discarded")
+
+	assert.Len(t, result.OutgoingMessages, 2)
+	assert.Empty(t, result.OutgoingEgresses)
+}
+
+func TestPermanentErrorDeadLetter(t *testing.T) {
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function:     StatefulFunctionPointer(poisonable),
+	})
+	assert.NoError(t, err)
+
+	builder.WithDeadLetters(DeadLetterEgress(TypeNameFrom("e/dead-letters")))
+
+	response, from := invokeBatch(t, builder, "poison", "hello")
+	assert.Equal(t, http.StatusOK, response.StatusCode, "received non-200 response")
+
+	result := from.GetInvocationResult()
+	assert.NotNil(t, result, "invocation result should not be nil")
+	assert.Len(t, result.OutgoingMessages, 1)
+	assert.Len(t, result.OutgoingEgresses, 1)
+
+	egress := result.OutgoingEgresses[0]
+	assert.Equal(t, "dead-letters", egress.EgressType)
+	assert.Equal(t, DeadLetterType.GetTypeName().String(), egress.Argument.Typename)
+
+	var record deadLetterRecord
+	assert.NoError(t, DeadLetterType.Deserialize(bytes.NewReader(egress.Argument.Value), &record))
+	assert.Equal(t, "greeter", record.Target.Type)
+	assert.Nil(t, record.Caller)
+	assert.Equal(t, "io.statefun.types/string", record.ValueTypeName)
+	assert.Contains(t, record.Error, "poison message")
+}
+
+func TestRetryableErrorFailsBatch(t *testing.T) {
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function:     StatefulFunctionPointer(poisonable),
+	})
+	assert.NoError(t, err)
+
+	builder.WithDeadLetters(DeadLetterEgress(TypeNameFrom("e/dead-letters")))
+
+	response, _ := invokeBatch(t, builder, "hello", "retry")
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, msg Message) error {
+			if msg.AsString() == "index" {
+				var empty []int
+				_ = empty[len(msg.AsString())]
+			}
+			panic(msg.AsString())
+		}),
+	})
+	assert.NoError(t, err)
+
+	var recovered []PanicError
+	builder.WithPanicHandler(func(self Address, err PanicError) {
+		assert.Equal(t, "0", self.Id)
+		recovered = append(recovered, err)
+	})
+
+	response, _ := invokeBatch(t, builder, "oops")
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+
+	response, _ = invokeBatch(t, builder, "index")
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+
+	assert.Len(t, recovered, 2)
+	assert.Equal(t, "oops", recovered[0].Value)
+	assert.NotEmpty(t, recovered[0].Stack)
+
+	var runtimeErr runtime.Error
+	assert.True(t, errors.As(recovered[1], &runtimeErr))
+}
+
+func greeterFunctions(t *testing.T) StatefulFunctions {
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function:     StatefulFunctionPointer(greeter),
+	})
+
+	assert.NoError(t, err, "registering a function should succeed")
+	return builder
+}
+
+// hides the length of the body, so that
+// the client uses chunked transfer encoding
+type chunkedReader struct {
+	io.Reader
+}
+
+func TestChunkedRequest(t *testing.T) {
+	server := httptest.NewServer(greeterFunctions(t).AsHandler())
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodPost, server.URL, chunkedReader{bytes.NewReader(encodeBatch("Hello"))})
+	request.Header.Set("Content-Type", "application/octet-stream")
+	assert.Equal(t, int64(0), request.ContentLength)
+
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var from protocol.FromFunction
+	responsebody, _ := ioutil.ReadAll(response.Body)
+	assert.NoError(t, proto.Unmarshal(responsebody, &from))
+	assert.Equal(t, strconv.Itoa(len(responsebody)), response.Header.Get("Content-Length"))
+	assert.NotNil(t, from.GetInvocationResult(), "invocation result should not be nil")
+}
+
+func TestUnknownContentLength(t *testing.T) {
+	handler := greeterFunctions(t).AsHandler()
+
+	for _, contentLength := range []int64{-1, 0} {
+		request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(encodeBatch("Hello")))
+		request.ContentLength = contentLength
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, "content length %d", contentLength)
+	}
+}
+
+func TestEmptyRequest(t *testing.T) {
+	server := httptest.NewServer(greeterFunctions(t).AsHandler())
+	defer server.Close()
+
+	response, err := http.Post(server.URL, "application/octet-stream", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response, err = http.Post(server.URL, "application/octet-stream", chunkedReader{strings.NewReader("")})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	request := encodeBatch("Hello")
+
+	builder := greeterFunctions(t)
+	builder.WithMaxRequestSize(int64(len(request)))
+
+	server := httptest.NewServer(builder.AsHandler())
+	defer server.Close()
+
+	response, err := http.Post(server.URL, "application/octet-stream", bytes.NewReader(request))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "a request of the maximum size should succeed")
+
+	large := encodeBatch("Hello", "there")
+
+	response, err = http.Post(server.URL, "application/octet-stream", bytes.NewReader(large))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
+
+	response, err = http.Post(server.URL, "application/octet-stream", chunkedReader{bytes.NewReader(large)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
+}
+
+func timeoutFunctions(t *testing.T, timeout time.Duration, function StatefulFunctionPointer) StatefulFunctions {
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function:     function,
+		Timeout:      timeout,
+	})
+
+	assert.NoError(t, err, "registering a function should succeed")
+	return builder
+}
+
+func TestInvocationTimeout(t *testing.T) {
+	// the function ignores its context, and is
+	// only released once the test completes
+	release := make(chan struct{})
+	defer close(release)
+
+	deadlines := make(chan time.Time, 1)
+	builder := timeoutFunctions(t, 50*time.Millisecond, func(ctx Context, msg Message) error {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	_, err := builder.AsHandler().Invoke(context.Background(), encodeBatch("Hello"))
+
+	var timeoutErr TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "expected a TimeoutError, got %v", err)
+	assert.Equal(t, TimeoutError{Timeout: 50 * time.Millisecond}, timeoutErr)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "invocation timed out after 50ms")
+
+	assert.WithinDuration(t, start.Add(50*time.Millisecond), <-deadlines, 25*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second, "the handler should not wait for the function")
+}
+
+func TestInvocationTimeoutObservedByFunction(t *testing.T) {
+	builder := timeoutFunctions(t, 10*time.Millisecond, func(ctx Context, msg Message) error {
+		<-ctx.Done()
+		return fmt.Errorf("gave up: %w", ctx.Err())
+	})
+
+	_, err := builder.AsHandler().Invoke(context.Background(), encodeBatch("Hello"))
+
+	var timeoutErr TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "expected a TimeoutError, got %v", err)
+	assert.Contains(t, err.Error(), "invocation timed out after 10ms")
+}
+
+func TestInvocationWithinTimeout(t *testing.T) {
+	builder := timeoutFunctions(t, time.Minute, StatefulFunctionPointer(greeter))
+
+	response, from := invokeBatch(t, builder, "Hello", "there")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotNil(t, from.GetInvocationResult(), "invocation result should not be nil")
+}
+
+func TestBatchTimeout(t *testing.T) {
+	var mutex sync.Mutex
+	var deadlines []time.Time
+	builder := timeoutFunctions(t, time.Hour, func(ctx Context, msg Message) error {
+		deadline, _ := ctx.Deadline()
+		mutex.Lock()
+		deadlines = append(deadlines, deadline)
+		mutex.Unlock()
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	builder.WithBatchTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	_, err := builder.AsHandler().Invoke(context.Background(), encodeBatch("1", "2", "3", "4", "5", "6"))
+
+	var timeoutErr TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "expected a TimeoutError, got %v", err)
+	assert.Equal(t, TimeoutError{Timeout: 100 * time.Millisecond, Batch: true}, timeoutErr)
+	assert.Contains(t, err.Error(), "invocation batch timed out after 100ms")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// the batch deadline is earlier than the function's timeout
+	assert.Less(t, len(deadlines), 6)
+	for _, deadline := range deadlines {
+		assert.WithinDuration(t, start.Add(100*time.Millisecond), deadline, 25*time.Millisecond)
+	}
+}
+
+func TestCanceledRequestIsNotTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	builder := timeoutFunctions(t, time.Minute, func(fctx Context, msg Message) error {
+		cancel()
+		<-fctx.Done()
+		return fctx.Err()
+	})
+
+	_, err := builder.AsHandler().Invoke(ctx, encodeBatch("Hello"))
+
+	var timeoutErr TimeoutError
+	assert.False(t, errors.As(err, &timeoutErr))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestNegativeTimeout(t *testing.T) {
+	err := StatefulFunctionsBuilder().WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		Function:     StatefulFunctionPointer(greeter),
+		Timeout:      -time.Second,
+	})
+
+	assert.Error(t, err)
+}
+
+func TestAbandonedInvocationIsDetached(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+
+	builder := timeoutFunctions(t, 20*time.Millisecond, func(ctx Context, msg Message) error {
+		<-release
+		ctx.Storage().Set(Seen, int32(7))
+		ctx.Send(MessageBuilder{
+			Target: Address{FunctionType: TypeNameFrom("org.foo/inbox"), Id: "0"},
+			Value:  "late",
+		})
+
+		defer close(finished)
+		panic("too late")
+	})
+
+	var panics int32
+	builder.WithPanicHandler(func(self Address, err PanicError) {
+		atomic.AddInt32(&panics, 1)
+	})
+
+	_, err := builder.AsHandler().Invoke(context.Background(), encodeBatch("Hello"))
+	var timeoutErr TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr), "expected a TimeoutError, got %v", err)
+
+	close(release)
+	<-finished
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&panics), "panics of abandoned invocations should be discarded")
+}
+
+func TestRequestDeadlineDoesNotAbandonInvocation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// without a Timeout or batch timeout, the
+	// function is invoked on the calling goroutine
+	builder := timeoutFunctions(t, 0, func(fctx Context, msg Message) error {
+		time.Sleep(30 * time.Millisecond)
+		fctx.Storage().Set(Seen, int32(1))
+		return nil
+	})
+
+	response, err := builder.AsHandler().Invoke(ctx, encodeBatch("Hello"))
+	assert.NoError(t, err)
+
+	var from protocol.FromFunction
+	assert.NoError(t, proto.Unmarshal(response, &from))
+	assert.Equal(t, "seen", from.GetInvocationResult().StateMutations[0].StateName)
+}
@@ -2,15 +2,31 @@ package internal
 
 import (
 	"bytes"
+	"io"
 	"statefun-sdk-go/pkg/statefun/internal/protocol"
 )
 
 // A mutable persisted value.
 // This struct is not thread safe.
 type Cell struct {
-	typedValue *protocol.TypedValue
-	buffer     bytes.Buffer
-	mutated    bool
+	typedValue   *protocol.TypedValue
+	buffer       bytes.Buffer
+	mutated      bool
+	checkpointed bool
+	saved        *cellState
+
+	// A decoded form of the value, so that it is not decoded
+	// on every access. If encode is set, the cached value was
+	// modified and the buffer is encoded from it when next read.
+	cached interface{}
+	encode func(value interface{}) []byte
+}
+
+type cellState struct {
+	value    []byte
+	typeName string
+	hasValue bool
+	mutated  bool
 }
 
 func NewCell(state *protocol.ToFunction_PersistedValue) *Cell {
@@ -18,37 +34,101 @@ func NewCell(state *protocol.ToFunction_PersistedValue) *Cell {
 		typedValue: state.StateValue,
 	}
 
-	_, _ = c.buffer.Read(c.typedValue.Value)
+	_, _ = c.buffer.Write(c.typedValue.Value)
 	c.typedValue.Value = nil
 	return c
 }
 
-func (c *Cell) Read(p []byte) (n int, err error) {
-	return c.buffer.Read(p)
+// Returns a reader over the current value. Reading
+// does not consume the value, so it may be read
+// any number of times.
+func (c *Cell) Reader() io.Reader {
+	c.flush()
+	return bytes.NewReader(c.buffer.Bytes())
 }
 
+// Appends to the current value. Callers should Reset
+// the cell before writing a new value.
 func (c *Cell) Write(p []byte) (n int, err error) {
-	c.buffer.Reset()
+	c.flush()
+	c.save()
+	c.cached = nil
 	c.mutated = true
 	c.typedValue.HasValue = true
 	return c.buffer.Write(p)
 }
 
 func (c *Cell) Reset() {
+	c.save()
+	c.cached = nil
+	c.encode = nil
 	c.mutated = true
 	c.typedValue.HasValue = false
 	c.buffer.Reset()
 }
 
+// Marks the current value so that it can later be restored
+// with Rollback. The value is only copied if the cell is
+// modified after the checkpoint.
+func (c *Cell) Checkpoint() {
+	c.flush()
+	c.checkpointed = true
+	c.saved = nil
+}
+
+// Restores the value as of the last call to Checkpoint,
+// discarding any modifications made since.
+func (c *Cell) Rollback() {
+	if c.saved != nil {
+		c.buffer.Reset()
+		_, _ = c.buffer.Write(c.saved.value)
+		c.typedValue.Typename = c.saved.typeName
+		c.typedValue.HasValue = c.saved.hasValue
+		c.mutated = c.saved.mutated
+	}
+
+	// the cached value may have been modified in place
+	c.cached = nil
+	c.encode = nil
+	c.saved = nil
+}
+
+func (c *Cell) save() {
+	if !c.checkpointed || c.saved != nil {
+		return
+	}
+
+	c.flush()
+
+	c.saved = &cellState{
+		value:    append([]byte(nil), c.buffer.Bytes()...),
+		typeName: c.typedValue.Typename,
+		hasValue: c.typedValue.HasValue,
+		mutated:  c.mutated,
+	}
+}
+
+// Returns the TypeName of the current value.
+func (c *Cell) TypeName() string {
+	return c.typedValue.Typename
+}
+
+// Sets the TypeName of the current value.
+func (c *Cell) SetTypeName(typeName string) {
+	c.save()
+	c.typedValue.Typename = typeName
+}
+
 func (c Cell) HasValue() bool {
 	return c.typedValue.HasValue
 }
 
-func (c Cell) GetStateMutation(name string) *protocol.FromFunction_PersistedValueMutation {
+func (c *Cell) GetStateMutation(name string) *protocol.FromFunction_PersistedValueMutation {
 	if !c.mutated {
 		return nil
 	}
 
+	c.flush()
 	mutationType := protocol.FromFunction_PersistedValueMutation_DELETE
 	if c.typedValue.HasValue {
 		mutationType = protocol.FromFunction_PersistedValueMutation_MODIFY
@@ -61,3 +141,60 @@ func (c Cell) GetStateMutation(name string) *protocol.FromFunction_PersistedValu
 		StateValue:   c.typedValue,
 	}
 }
+
+// Returns a copy of the cell, whose modifications
+// do not affect the original.
+func (c *Cell) Clone() *Cell {
+	// the cached value is not shared, since it
+	// may be modified in place by either cell
+	c.flush()
+	clone := &Cell{
+		typedValue: &protocol.TypedValue{
+			Typename: c.typedValue.Typename,
+			HasValue: c.typedValue.HasValue,
+		},
+		mutated:      c.mutated,
+		checkpointed: c.checkpointed,
+	}
+
+	_, _ = clone.buffer.Write(c.buffer.Bytes())
+	if c.saved != nil {
+		saved := *c.saved
+		clone.saved = &saved
+	}
+
+	return clone
+}
+
+// Returns the decoded value cached by SetCached or UpdateCached,
+// or nil if the value has not been decoded since it was written.
+func (c *Cell) Cached() interface{} {
+	return c.cached
+}
+
+// Caches the decoded form of the current value.
+func (c *Cell) SetCached(value interface{}) {
+	c.cached = value
+}
+
+// Modifies the cached value with update, which may change it in
+// place. The value is only encoded once it is read, the cell is
+// checkpointed, or the mutation is sent to the runtime, so that
+// any number of updates within an invocation encode it once.
+func (c *Cell) UpdateCached(update func(cached interface{}) interface{}, encode func(value interface{}) []byte) {
+	c.save()
+	c.mutated = true
+	c.typedValue.HasValue = true
+	c.cached = update(c.cached)
+	c.encode = encode
+}
+
+func (c *Cell) flush() {
+	if c.encode == nil {
+		return
+	}
+
+	c.buffer.Reset()
+	_, _ = c.buffer.Write(c.encode(c.cached))
+	c.encode = nil
+}
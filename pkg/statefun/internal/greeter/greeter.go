@@ -0,0 +1,54 @@
+// Package greeter provides the function used by the tests of the
+// transports in statefun/grpc and statefun/lambda, which invoke it
+// with the id bob and the argument "bob".
+package greeter
+
+import (
+	"statefun-sdk-go/pkg/statefun"
+)
+
+var (
+	FunctionType = statefun.TypeNameFrom("org.foo/greeter")
+
+	// The function type greetings are sent to.
+	Inbox = statefun.TypeNameFrom("org.foo/inbox")
+)
+
+// The number of messages the greeter has seen.
+var Seen = statefun.ValueSpec{
+	Name:      "seen",
+	ValueType: statefun.Int32Type,
+}
+
+// Increments Seen and sends a greeting to the Inbox with the same id.
+func Greeter(ctx statefun.Context, message statefun.Message) error {
+	var count int32
+	ctx.Storage().Get(Seen, &count)
+	ctx.Storage().Set(Seen, count+1)
+
+	ctx.Send(statefun.MessageBuilder{
+		Target: statefun.Address{
+			FunctionType: Inbox,
+			Id:           ctx.Self().Id,
+		},
+		Value: "hello " + message.AsString(),
+	})
+
+	return nil
+}
+
+// Creates a registry with the Greeter registered.
+func Functions() statefun.StatefulFunctions {
+	builder := statefun.StatefulFunctionsBuilder()
+	err := builder.WithSpec(statefun.StatefulFunctionSpec{
+		FunctionType: FunctionType,
+		States:       []statefun.ValueSpec{Seen},
+		Function:     statefun.StatefulFunctionPointer(Greeter),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return builder
+}
@@ -0,0 +1,129 @@
+// Package lambda serves a statefun.RequestReplyHandler from AWS Lambda,
+// behind an API Gateway REST API (payload format 1.0), an HTTP API
+// (payload format 2.0), or a Lambda function URL.
+//
+// The returned handler has the signature expected by the AWS Lambda
+// Go runtime, so it can be started with github.com/aws/aws-lambda-go:
+//
+//	functions := statefun.StatefulFunctionsBuilder()
+//	...
+//	lambda.Start(statefunlambda.Handler(functions.AsHandler()))
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"statefun-sdk-go/pkg/statefun"
+	"strings"
+)
+
+// The subset of an API Gateway or function URL event used by the
+// handler. Both payload format versions share the headers, body and
+// encoding fields, and differ in where they hold the request method.
+type Request struct {
+	Version         string            `json:"version"`
+	HTTPMethod      string            `json:"httpMethod"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		HTTP struct {
+			Method string `json:"method"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// Returns the HTTP method of the request in either payload format.
+func (r *Request) Method() string {
+	if r.HTTPMethod != "" {
+		return r.HTTPMethod
+	}
+
+	return r.RequestContext.HTTP.Method
+}
+
+// Returns the value of the header, ignoring case. Payload format 2.0
+// lowercases header names, while format 1.0 keeps them as sent.
+func (r *Request) Header(name string) string {
+	for key, value := range r.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// A response event, understood by API Gateway for both payload
+// format versions and by Lambda function URLs.
+type Response struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// Creates a Lambda handler that decodes the request event, invokes
+// the RequestReplyHandler with its body, and encodes the result as a
+// response event. Like RequestReplyHandler's ServeHTTP method, it
+// responds with 405 to methods other than POST, 415 to content types
+// other than application/octet-stream, 400 to requests without a
+// body, and 500 if the invocation fails.
+func Handler(handler statefun.RequestReplyHandler) func(context.Context, json.RawMessage) (Response, error) {
+	return func(ctx context.Context, event json.RawMessage) (Response, error) {
+		var request Request
+		if err := json.Unmarshal(event, &request); err != nil {
+			return Response{}, fmt.Errorf("failed to decode Lambda event: %w", err)
+		}
+
+		return Invoke(ctx, handler, &request), nil
+	}
+}
+
+// Invokes the RequestReplyHandler with the decoded request event.
+func Invoke(ctx context.Context, handler statefun.RequestReplyHandler, request *Request) Response {
+	if request.Method() != http.MethodPost {
+		return errorResponse(http.StatusMethodNotAllowed, errors.New("invalid request method"))
+	}
+
+	contentType := request.Header("Content-Type")
+	if contentType != "" && contentType != "application/octet-stream" {
+		return errorResponse(http.StatusUnsupportedMediaType, errors.New("invalid content type"))
+	}
+
+	if request.Body == "" {
+		return errorResponse(http.StatusBadRequest, errors.New("empty request body"))
+	}
+
+	payload := []byte(request.Body)
+	if request.IsBase64Encoded {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(request.Body); err != nil {
+			return errorResponse(http.StatusBadRequest, fmt.Errorf("invalid base64 body: %w", err))
+		}
+	}
+
+	response, err := handler.Invoke(ctx, payload)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err)
+	}
+
+	return Response{
+		StatusCode:      http.StatusOK,
+		Headers:         map[string]string{"Content-Type": "application/octet-stream"},
+		Body:            base64.StdEncoding.EncodeToString(response),
+		IsBase64Encoded: true,
+	}
+}
+
+func errorResponse(statusCode int, err error) Response {
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		Body:       err.Error(),
+	}
+}
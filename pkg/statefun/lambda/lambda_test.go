@@ -0,0 +1,145 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"statefun-sdk-go/pkg/statefun/internal/greeter"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"testing"
+)
+
+func testHandler() func(context.Context, json.RawMessage) (Response, error) {
+	return Handler(greeter.Functions().AsHandler())
+}
+
+// loads a recorded event, whose body is a ToFunction request
+// invoking org.foo/greeter with id bob, the argument "bob",
+// and a seen value of 1
+func loadEvent(t *testing.T, name string) map[string]interface{} {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	assert.NoError(t, err)
+
+	var event map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &event))
+	return event
+}
+
+func invoke(t *testing.T, event map[string]interface{}) Response {
+	data, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	response, err := testHandler()(context.Background(), data)
+	assert.NoError(t, err)
+	return response
+}
+
+func TestRecordedEvents(t *testing.T) {
+	for _, name := range []string{"apigateway-v1.json", "apigateway-v2.json", "function-url.json"} {
+		t.Run(name, func(t *testing.T) {
+			response := invoke(t, loadEvent(t, name))
+
+			assert.Equal(t, http.StatusOK, response.StatusCode, response.Body)
+			assert.Equal(t, "application/octet-stream", response.Headers["Content-Type"])
+			assert.True(t, response.IsBase64Encoded)
+
+			body, err := base64.StdEncoding.DecodeString(response.Body)
+			assert.NoError(t, err)
+
+			var from protocol.FromFunction
+			assert.NoError(t, proto.Unmarshal(body, &from))
+
+			result := from.GetInvocationResult()
+			assert.NotNil(t, result, "invocation result should not be nil")
+
+			assert.Equal(t, "seen", result.StateMutations[0].StateName)
+			assert.Equal(t, protocol.FromFunction_PersistedValueMutation_MODIFY, result.StateMutations[0].MutationType)
+			assert.Equal(t, []byte{0x0d, 0x02, 0x00, 0x00, 0x00}, result.StateMutations[0].StateValue.Value)
+
+			assert.Equal(t, &protocol.Address{
+				Namespace: "org.foo",
+				Type:      "inbox",
+				Id:        "bob",
+			}, result.OutgoingMessages[0].Target)
+		})
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		modify     func(event map[string]interface{})
+		statusCode int
+	}{
+		{
+			name: "v1 method",
+			file: "apigateway-v1.json",
+			modify: func(event map[string]interface{}) {
+				event["httpMethod"] = "GET"
+			},
+			statusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "v2 method",
+			file: "apigateway-v2.json",
+			modify: func(event map[string]interface{}) {
+				event["requestContext"].(map[string]interface{})["http"].(map[string]interface{})["method"] = "GET"
+			},
+			statusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name: "content type",
+			file: "function-url.json",
+			modify: func(event map[string]interface{}) {
+				event["headers"].(map[string]interface{})["content-type"] = "application/json"
+			},
+			statusCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "empty body",
+			file: "apigateway-v1.json",
+			modify: func(event map[string]interface{}) {
+				delete(event, "body")
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name: "invalid base64",
+			file: "apigateway-v2.json",
+			modify: func(event map[string]interface{}) {
+				event["body"] = "not base64!"
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name: "invalid payload",
+			file: "function-url.json",
+			modify: func(event map[string]interface{}) {
+				event["body"] = base64.StdEncoding.EncodeToString([]byte{0xff, 0xff, 0xff})
+			},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := loadEvent(t, test.file)
+			test.modify(event)
+
+			response := invoke(t, event)
+			assert.Equal(t, test.statusCode, response.StatusCode, response.Body)
+			assert.False(t, response.IsBase64Encoded)
+		})
+	}
+}
+
+func TestInvalidEvent(t *testing.T) {
+	_, err := testHandler()(context.Background(), json.RawMessage(`"not an event"`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package statefun
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// A Logger receives structured log events from the SDK.
+//
+// Each event consists of a message followed by alternating
+// key-value pairs, in the same style as log/slog. A *slog.Logger
+// can be adapted to this interface by forwarding each method and
+// wrapping the result of With.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+
+	Info(msg string, keysAndValues ...interface{})
+
+	Error(msg string, keysAndValues ...interface{})
+
+	// Returns a Logger that includes the given
+	// key-value pairs with every event.
+	With(keysAndValues ...interface{}) Logger
+}
+
+// The minimum severity of events written by a standard Logger.
+type LogLevel int
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	ErrorLevel
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case ErrorLevel:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+	fields string
+}
+
+// Creates a Logger that writes events at or above the given
+// level to a standard library *log.Logger, formatted as
+// `LEVEL message key=value ...`.
+func NewStdLogger(logger *log.Logger, level LogLevel) Logger {
+	return stdLogger{
+		logger: logger,
+		level:  level,
+	}
+}
+
+func defaultLogger() Logger {
+	return NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), InfoLevel)
+}
+
+func (s stdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	s.log(DebugLevel, msg, keysAndValues)
+}
+
+func (s stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	s.log(InfoLevel, msg, keysAndValues)
+}
+
+func (s stdLogger) Error(msg string, keysAndValues ...interface{}) {
+	s.log(ErrorLevel, msg, keysAndValues)
+}
+
+func (s stdLogger) With(keysAndValues ...interface{}) Logger {
+	s.fields += formatFields(keysAndValues)
+	return s
+}
+
+func (s stdLogger) log(level LogLevel, msg string, keysAndValues []interface{}) {
+	if level < s.level {
+		return
+	}
+
+	s.logger.Printf("%s %s%s%s", level, msg, s.fields, formatFields(keysAndValues))
+}
+
+func formatFields(keysAndValues []interface{}) string {
+	builder := strings.Builder{}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		builder.WriteByte(' ')
+		if i+1 == len(keysAndValues) {
+			_, _ = fmt.Fprintf(&builder, "!BADKEY=%v", keysAndValues[i])
+			break
+		}
+
+		_, _ = fmt.Fprintf(&builder, "%v=%s", keysAndValues[i], formatValue(keysAndValues[i+1]))
+	}
+
+	return builder.String()
+}
+
+func formatValue(value interface{}) string {
+	formatted := fmt.Sprintf("%v", value)
+	if strings.ContainsAny(formatted, " \t\n\"=") {
+		return fmt.Sprintf("%q", formatted)
+	}
+
+	return formatted
+}
+
+type nopLogger struct{}
+
+// Returns a Logger that discards all events.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (n nopLogger) Debug(string, ...interface{}) {}
+
+func (n nopLogger) Info(string, ...interface{}) {}
+
+func (n nopLogger) Error(string, ...interface{}) {}
+
+func (n nopLogger) With(...interface{}) Logger {
+	return n
+}
@@ -0,0 +1,119 @@
+package statefun
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	buffer := bytes.Buffer{}
+	logger := NewStdLogger(log.New(&buffer, "", 0), InfoLevel).With("function_type", "org.foo/greeter")
+
+	logger.Debug("ignored")
+	logger.Info("hello", "address_id", "0", "error", "something bad")
+
+	assert.Equal(t, "INFO hello function_type=org.foo/greeter address_id=0 error=\"something bad\"\n", buffer.String())
+}
+
+type logEvent struct {
+	level  LogLevel
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	mutex  *sync.Mutex
+	events *[]logEvent
+	fields []interface{}
+}
+
+func newRecordingLogger() recordingLogger {
+	return recordingLogger{
+		mutex:  &sync.Mutex{},
+		events: &[]logEvent{},
+	}
+}
+
+func (r recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	r.record(DebugLevel, msg, keysAndValues)
+}
+
+func (r recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	r.record(InfoLevel, msg, keysAndValues)
+}
+
+func (r recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	r.record(ErrorLevel, msg, keysAndValues)
+}
+
+func (r recordingLogger) With(keysAndValues ...interface{}) Logger {
+	r.fields = append(append([]interface{}{}, r.fields...), keysAndValues...)
+	return r
+}
+
+func (r recordingLogger) record(level LogLevel, msg string, keysAndValues []interface{}) {
+	fields := map[string]interface{}{}
+	all := append(append([]interface{}{}, r.fields...), keysAndValues...)
+	for i := 0; i+1 < len(all); i += 2 {
+		fields[all[i].(string)] = all[i+1]
+	}
+
+	r.mutex.Lock()
+	*r.events = append(*r.events, logEvent{level: level, msg: msg, fields: fields})
+	r.mutex.Unlock()
+}
+
+func (r recordingLogger) find(msg string) *logEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, event := range *r.events {
+		if event.msg == msg {
+			return &event
+		}
+	}
+
+	return nil
+}
+
+func TestHandlerLogsBatches(t *testing.T) {
+	logger := newRecordingLogger()
+
+	builder := StatefulFunctionsBuilder()
+	builder.WithLogger(logger)
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, msg Message) error {
+			ctx.Logger().Info("invoked")
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	response, _ := invokeBatch(t, builder, "hello", "world")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	registered := logger.find("registered stateful function")
+	assert.NotNil(t, registered)
+	assert.Equal(t, "org.foo/greeter", registered.fields["function_type"])
+	assert.Equal(t, []string{"seen"}, registered.fields["states"])
+
+	invoked := logger.find("invoked")
+	assert.NotNil(t, invoked)
+	assert.True(t, strings.HasPrefix(invoked.fields["self"].(string), "Address(org.foo, greeter, 0)"))
+	assert.NotContains(t, invoked.fields, "caller")
+
+	completed := logger.find("invocation batch completed")
+	assert.NotNil(t, completed)
+	assert.Equal(t, DebugLevel, completed.level)
+	assert.Equal(t, "0", completed.fields["address_id"])
+	assert.Equal(t, 2, completed.fields["batch_size"])
+	assert.Equal(t, []string{"seen"}, completed.fields["states"])
+	assert.Contains(t, completed.fields, "latency")
+}
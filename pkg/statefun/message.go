@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"time"
 )
 
 type MessageBuilder struct {
@@ -26,6 +27,8 @@ func (m MessageBuilder) ToMessage() (Message, error) {
 		switch m.Value.(type) {
 		case int:
 			return Message{}, errors.New("ambiguous integer type; please specify int32 or int64")
+		case uint:
+			return Message{}, errors.New("ambiguous integer type; please specify uint32 or uint64")
 		case bool, *bool:
 			m.ValueType = BoolType
 		case int32, *int32:
@@ -38,6 +41,16 @@ func (m MessageBuilder) ToMessage() (Message, error) {
 			m.ValueType = Float64Type
 		case string, *string:
 			m.ValueType = StringType
+		case []byte, *[]byte:
+			m.ValueType = BytesType
+		case uint32, *uint32:
+			m.ValueType = Uint32Type
+		case uint64, *uint64:
+			m.ValueType = Uint64Type
+		case time.Time, *time.Time:
+			m.ValueType = TimeType
+		case time.Duration, *time.Duration:
+			m.ValueType = DurationType
 		default:
 			return Message{}, errors.New("message contains non-primitive type, please supply a non-nil SimpleType")
 		}
@@ -141,6 +154,66 @@ func (m *Message) AsString() string {
 	return receiver
 }
 
+func (m *Message) IsBytes() bool {
+	return m.Is(BytesType)
+}
+
+func (m *Message) AsBytes() []byte {
+	var receiver []byte
+	if err := BytesType.Deserialize(bytes.NewReader(m.typedValue.Value), &receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize message: %w", err))
+	}
+	return receiver
+}
+
+func (m *Message) IsUint32() bool {
+	return m.Is(Uint32Type)
+}
+
+func (m *Message) AsUint32() uint32 {
+	var receiver uint32
+	if err := Uint32Type.Deserialize(bytes.NewReader(m.typedValue.Value), &receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize message: %w", err))
+	}
+	return receiver
+}
+
+func (m *Message) IsUint64() bool {
+	return m.Is(Uint64Type)
+}
+
+func (m *Message) AsUint64() uint64 {
+	var receiver uint64
+	if err := Uint64Type.Deserialize(bytes.NewReader(m.typedValue.Value), &receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize message: %w", err))
+	}
+	return receiver
+}
+
+func (m *Message) IsTime() bool {
+	return m.Is(TimeType)
+}
+
+func (m *Message) AsTime() time.Time {
+	var receiver time.Time
+	if err := TimeType.Deserialize(bytes.NewReader(m.typedValue.Value), &receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize message: %w", err))
+	}
+	return receiver
+}
+
+func (m *Message) IsDuration() bool {
+	return m.Is(DurationType)
+}
+
+func (m *Message) AsDuration() time.Duration {
+	var receiver time.Duration
+	if err := DurationType.Deserialize(bytes.NewReader(m.typedValue.Value), &receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize message: %w", err))
+	}
+	return receiver
+}
+
 func (m *Message) Is(t SimpleType) bool {
 	return t.GetTypeName().String() == m.typedValue.Typename
 }
@@ -3,6 +3,7 @@ package statefun
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestBasicIntMessage(t *testing.T) {
@@ -43,3 +44,44 @@ func TestMessageWithType(t *testing.T) {
 	value := message.AsFloat32()
 	assert.Equal(t, value, float32(5.0))
 }
+
+func TestInferredMessageTypes(t *testing.T) {
+	typename, err := ParseTypeName("foo/bar")
+	assert.NoError(t, err)
+
+	now := time.Unix(1700000000, 42).UTC()
+	cases := []struct {
+		value     interface{}
+		valueType SimpleType
+	}{
+		{[]byte("hello"), BytesType},
+		{uint32(7), Uint32Type},
+		{uint64(7), Uint64Type},
+		{now, TimeType},
+		{time.Second, DurationType},
+	}
+
+	for _, c := range cases {
+		message, err := MessageBuilder{
+			Target: Address{
+				FunctionType: typename,
+				Id:           "a",
+			},
+			Value: c.value,
+		}.ToMessage()
+
+		assert.NoError(t, err)
+		assert.True(t, message.Is(c.valueType), "expected %T to be inferred as %s", c.value, c.valueType.GetTypeName())
+	}
+
+	message, _ := MessageBuilder{Target: Address{FunctionType: typename, Id: "a"}, Value: now}.ToMessage()
+	assert.True(t, message.IsTime())
+	assert.Equal(t, message.AsTime(), now)
+
+	message, _ = MessageBuilder{Target: Address{FunctionType: typename, Id: "a"}, Value: []byte("hello")}.ToMessage()
+	assert.True(t, message.IsBytes())
+	assert.Equal(t, message.AsBytes(), []byte("hello"))
+
+	_, err = MessageBuilder{Target: Address{FunctionType: typename, Id: "a"}, Value: uint(1)}.ToMessage()
+	assert.Error(t, err)
+}
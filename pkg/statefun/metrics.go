@@ -0,0 +1,66 @@
+package statefun
+
+// Labels identify a single series of a metric,
+// such as the function type being invoked.
+type Labels map[string]string
+
+// Metrics receives measurements from the RequestReplyHandler.
+// Implementations must be safe for concurrent use. See the
+// prometheus package for an implementation that serves the
+// Prometheus text exposition format.
+type Metrics interface {
+	// Adds delta to the counter identified by name and labels.
+	IncCounter(name string, labels Labels, delta float64)
+
+	// Records an observation in the histogram
+	// identified by name and labels.
+	Observe(name string, labels Labels, value float64)
+}
+
+// The metrics recorded by the RequestReplyHandler. All metrics carry the
+// LabelFunctionType label, while state metrics additionally carry LabelState.
+const (
+	// Counter of messages processed by a function.
+	MetricInvocations = "statefun_invocations_total"
+
+	// Histogram of the number of messages in each batch.
+	MetricBatchSize = "statefun_batch_size"
+
+	// Histogram of the time spent in StatefulFunction.Invoke, in seconds.
+	MetricInvocationLatency = "statefun_invocation_duration_seconds"
+
+	// Counter of invocations that returned an error or panicked.
+	MetricErrors = "statefun_invocation_errors_total"
+
+	// Counter of invocations that panicked.
+	MetricPanics = "statefun_invocation_panics_total"
+
+	// Counter of batches answered with a request for missing state values.
+	MetricIncompleteContexts = "statefun_incomplete_invocation_contexts_total"
+
+	// Counter of messages sent to other functions.
+	MetricOutgoingMessages = "statefun_outgoing_messages_total"
+
+	// Counter of delayed messages sent to other functions.
+	MetricDelayedMessages = "statefun_delayed_messages_total"
+
+	// Counter of messages sent to egresses.
+	MetricEgressMessages = "statefun_egress_messages_total"
+
+	// Counter of bytes of state received from the runtime, per ValueSpec.
+	MetricStateBytesRead = "statefun_state_read_bytes_total"
+
+	// Counter of bytes of state written back to the runtime, per ValueSpec.
+	MetricStateBytesWritten = "statefun_state_written_bytes_total"
+)
+
+const (
+	LabelFunctionType = "function_type"
+	LabelState        = "state"
+)
+
+type nopMetrics struct{}
+
+func (n nopMetrics) IncCounter(string, Labels, float64) {}
+
+func (n nopMetrics) Observe(string, Labels, float64) {}
@@ -0,0 +1,180 @@
+package statefun
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	httpEndpointKind   = "io.statefun.endpoints.v2/http"
+	asyncTransportType = "io.statefun.transports.v1/async"
+)
+
+// An Endpoint describes how the StateFun runtime reaches the
+// functions of a StatefulFunctions registry, and is used to render
+// the remote module specification (module.yaml) with WriteModuleYaml.
+type Endpoint struct {
+	// The URL the functions are served at. It may contain the
+	// {function.name} placeholder, which the runtime replaces
+	// with the type of the invoked function.
+	UrlPathTemplate string
+
+	// Uses the asynchronous transport, based on Netty, instead of
+	// the default synchronous transport, based on OkHttp.
+	Async bool
+
+	// Optional timeouts. A zero value keeps the runtime's default.
+	CallTimeout    time.Duration
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	// The maximum number of invocations the runtime batches
+	// into a single request. Zero keeps the runtime's default.
+	MaxNumBatchRequests int
+
+	// Renders a single endpoint for all function types of a
+	// namespace, using a namespace/* pattern, instead of an
+	// endpoint for every registered function type.
+	GroupByNamespace bool
+}
+
+type endpointYaml struct {
+	Kind string           `yaml:"kind"`
+	Spec endpointSpecYaml `yaml:"spec"`
+}
+
+type endpointSpecYaml struct {
+	Functions           string         `yaml:"functions"`
+	UrlPathTemplate     string         `yaml:"urlPathTemplate"`
+	Transport           *transportYaml `yaml:"transport,omitempty"`
+	MaxNumBatchRequests int            `yaml:"maxNumBatchRequests,omitempty"`
+}
+
+type transportYaml struct {
+	Type     string        `yaml:"type,omitempty"`
+	Call     string        `yaml:"call,omitempty"`
+	Connect  string        `yaml:"connect,omitempty"`
+	Timeouts *timeoutsYaml `yaml:"timeouts,omitempty"`
+}
+
+type timeoutsYaml struct {
+	Call    string `yaml:"call,omitempty"`
+	Connect string `yaml:"connect,omitempty"`
+	Read    string `yaml:"read,omitempty"`
+	Write   string `yaml:"write,omitempty"`
+}
+
+func (h *handler) WriteModuleYaml(writer io.Writer, endpoint Endpoint) error {
+	if endpoint.UrlPathTemplate == "" {
+		return errors.New("an endpoint requires a UrlPathTemplate")
+	}
+
+	transport, err := endpoint.transport()
+	if err != nil {
+		return err
+	}
+
+	patterns := make([]string, 0, len(h.module))
+	seen := map[string]bool{}
+	for typeName := range h.module {
+		pattern := typeName.String()
+		if endpoint.GroupByNamespace {
+			pattern = typeName.GetNamespace() + "/*"
+		}
+
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+
+	if len(patterns) == 0 {
+		return errors.New("no stateful functions are registered")
+	}
+
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	for _, pattern := range patterns {
+		err := encoder.Encode(endpointYaml{
+			Kind: httpEndpointKind,
+			Spec: endpointSpecYaml{
+				Functions:           pattern,
+				UrlPathTemplate:     endpoint.UrlPathTemplate,
+				Transport:           transport,
+				MaxNumBatchRequests: endpoint.MaxNumBatchRequests,
+			},
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+func (e Endpoint) transport() (*transportYaml, error) {
+	for _, timeout := range []time.Duration{e.CallTimeout, e.ConnectTimeout, e.ReadTimeout, e.WriteTimeout} {
+		if timeout < 0 {
+			return nil, errors.New("endpoint timeouts cannot be negative")
+		}
+	}
+
+	if e.Async {
+		if e.ReadTimeout != 0 || e.WriteTimeout != 0 {
+			return nil, errors.New("the async transport does not support read and write timeouts")
+		}
+
+		return &transportYaml{
+			Type:    asyncTransportType,
+			Call:    flinkDuration(e.CallTimeout),
+			Connect: flinkDuration(e.ConnectTimeout),
+		}, nil
+	}
+
+	timeouts := timeoutsYaml{
+		Call:    flinkDuration(e.CallTimeout),
+		Connect: flinkDuration(e.ConnectTimeout),
+		Read:    flinkDuration(e.ReadTimeout),
+		Write:   flinkDuration(e.WriteTimeout),
+	}
+
+	if timeouts == (timeoutsYaml{}) {
+		return nil, nil
+	}
+
+	return &transportYaml{Timeouts: &timeouts}, nil
+}
+
+// Formats the duration in the format parsed by Flink,
+// using the largest unit that represents it exactly.
+func flinkDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "h"},
+		{time.Minute, "min"},
+		{time.Second, "s"},
+		{time.Millisecond, "ms"},
+		{time.Microsecond, "us"},
+	}
+
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d%s", d/u.unit, u.name)
+		}
+	}
+
+	return fmt.Sprintf("%dns", d.Nanoseconds())
+}
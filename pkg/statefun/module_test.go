@@ -0,0 +1,96 @@
+package statefun
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func moduleFunctions(t *testing.T) StatefulFunctions {
+	builder := StatefulFunctionsBuilder()
+	for _, name := range []string{"org.foo/greeter", "org.foo/person", "org.bar/audit"} {
+		err := builder.WithSpec(StatefulFunctionSpec{
+			FunctionType: TypeNameFrom(name),
+			Function:     StatefulFunctionPointer(greeter),
+		})
+		assert.NoError(t, err)
+	}
+	return builder
+}
+
+func TestWriteModuleYaml(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := moduleFunctions(t).WriteModuleYaml(&buffer, Endpoint{
+		UrlPathTemplate:     "http://functions:8000/statefun",
+		CallTimeout:         2 * time.Minute,
+		ConnectTimeout:      10 * time.Second,
+		MaxNumBatchRequests: 500,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, `kind: io.statefun.endpoints.v2/http
+spec:
+  functions: org.bar/audit
+  urlPathTemplate: http://functions:8000/statefun
+  transport:
+    timeouts:
+      call: 2min
+      connect: 10s
+  maxNumBatchRequests: 500
+---
+kind: io.statefun.endpoints.v2/http
+spec:
+  functions: org.foo/greeter
+  urlPathTemplate: http://functions:8000/statefun
+  transport:
+    timeouts:
+      call: 2min
+      connect: 10s
+  maxNumBatchRequests: 500
+---
+kind: io.statefun.endpoints.v2/http
+spec:
+  functions: org.foo/person
+  urlPathTemplate: http://functions:8000/statefun
+  transport:
+    timeouts:
+      call: 2min
+      connect: 10s
+  maxNumBatchRequests: 500
+`, buffer.String())
+}
+
+func TestWriteModuleYamlByNamespace(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := moduleFunctions(t).WriteModuleYaml(&buffer, Endpoint{
+		UrlPathTemplate:  "http://functions:8000/{function.name}",
+		Async:            true,
+		CallTimeout:      1500 * time.Millisecond,
+		GroupByNamespace: true,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, `kind: io.statefun.endpoints.v2/http
+spec:
+  functions: org.bar/*
+  urlPathTemplate: http://functions:8000/{function.name}
+  transport:
+    type: io.statefun.transports.v1/async
+    call: 1500ms
+---
+kind: io.statefun.endpoints.v2/http
+spec:
+  functions: org.foo/*
+  urlPathTemplate: http://functions:8000/{function.name}
+  transport:
+    type: io.statefun.transports.v1/async
+    call: 1500ms
+`, buffer.String())
+
+	err = moduleFunctions(t).WriteModuleYaml(&buffer, Endpoint{UrlPathTemplate: "http://functions", Async: true, ReadTimeout: time.Second})
+	assert.Error(t, err, "the async transport has no read timeout")
+
+	err = StatefulFunctionsBuilder().WriteModuleYaml(&buffer, Endpoint{UrlPathTemplate: "http://functions"})
+	assert.Error(t, err, "a module requires at least one function")
+}
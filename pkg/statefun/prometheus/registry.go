@@ -0,0 +1,227 @@
+// Package prometheus provides an implementation of statefun.Metrics
+// that serves the Prometheus text exposition format, without
+// depending on the Prometheus client libraries.
+//
+//	registry := prometheus.NewRegistry()
+//	builder.WithMetrics(registry)
+//
+//	http.Handle("/metrics", registry)
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"statefun-sdk-go/pkg/statefun"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The default histogram buckets, suitable
+// for latencies measured in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// The histogram buckets used for statefun.MetricBatchSize.
+var BatchSizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// A Registry stores counters and histograms in memory and
+// exposes them in the Prometheus text exposition format.
+// It implements both statefun.Metrics and http.Handler.
+type Registry struct {
+	mutex    sync.Mutex
+	buckets  map[string][]float64
+	families map[string]*family
+}
+
+const (
+	counterType   = "counter"
+	histogramType = "histogram"
+)
+
+type family struct {
+	metricType string
+	series     map[string]*series
+}
+
+type series struct {
+	labels  string
+	value   float64
+	buckets []float64
+	counts  []uint64
+	count   uint64
+}
+
+var _ statefun.Metrics = &Registry{}
+
+// Creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets: map[string][]float64{
+			statefun.MetricBatchSize: BatchSizeBuckets,
+		},
+		families: map[string]*family{},
+	}
+}
+
+// Sets the upper bounds of the buckets used for the histogram
+// with the given name. Series that have already been observed
+// keep their existing buckets.
+func (r *Registry) WithBuckets(name string, buckets []float64) *Registry {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	r.mutex.Lock()
+	r.buckets[name] = sorted
+	r.mutex.Unlock()
+
+	return r
+}
+
+func (r *Registry) IncCounter(name string, labels statefun.Labels, delta float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.series(name, counterType, labels).value += delta
+}
+
+func (r *Registry) Observe(name string, labels statefun.Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.series(name, histogramType, labels)
+	for i, bound := range s.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+
+	s.count++
+	s.value += value
+}
+
+// Returns the series for the given metric, creating it if
+// necessary. The caller must hold the mutex.
+func (r *Registry) series(name, metricType string, labels statefun.Labels) *series {
+	f, exists := r.families[name]
+	if !exists {
+		f = &family{metricType: metricType, series: map[string]*series{}}
+		r.families[name] = f
+	}
+
+	key := formatLabels(labels)
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labels: key}
+		if metricType == histogramType {
+			s.buckets = DefaultBuckets
+			if buckets, ok := r.buckets[name]; ok {
+				s.buckets = buckets
+			}
+			s.counts = make([]uint64, len(s.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+func (r *Registry) ServeHTTP(writer http.ResponseWriter, _ *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(writer)
+}
+
+// Writes all metrics in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	out := bufio.NewWriter(w)
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		_, _ = fmt.Fprintf(out, "# TYPE %s %s\n", name, f.metricType)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.metricType == counterType {
+				_, _ = fmt.Fprintf(out, "%s%s %s\n", name, braces(s.labels), formatFloat(s.value))
+				continue
+			}
+
+			for i, bound := range s.buckets {
+				le := fmt.Sprintf("le=\"%s\"", formatFloat(bound))
+				_, _ = fmt.Fprintf(out, "%s_bucket%s %d\n", name, braces(join(s.labels, le)), s.counts[i])
+			}
+
+			_, _ = fmt.Fprintf(out, "%s_bucket%s %d\n", name, braces(join(s.labels, `le="+Inf"`)), s.count)
+			_, _ = fmt.Fprintf(out, "%s_sum%s %s\n", name, braces(s.labels), formatFloat(s.value))
+			_, _ = fmt.Fprintf(out, "%s_count%s %d\n", name, braces(s.labels), s.count)
+		}
+	}
+
+	return out.Flush()
+}
+
+func formatLabels(labels statefun.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape(labels[name])))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+
+	return "{" + labels + "}"
+}
+
+func join(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+
+	return labels + "," + label
+}
@@ -0,0 +1,86 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"statefun-sdk-go/pkg/statefun"
+	"statefun-sdk-go/pkg/statefun/statefuntest"
+	"testing"
+)
+
+func TestRegistryFormat(t *testing.T) {
+	registry := NewRegistry().WithBuckets("latency", []float64{1, 0.5})
+
+	registry.IncCounter("requests_total", statefun.Labels{"b": "2", "a": "say \"hi\""}, 1)
+	registry.IncCounter("requests_total", statefun.Labels{"b": "2", "a": "say \"hi\""}, 2)
+	registry.Observe("latency", nil, 0.7)
+	registry.Observe("latency", nil, 3)
+
+	buffer := bytes.Buffer{}
+	assert.NoError(t, registry.Write(&buffer))
+
+	assert.Equal(t, `# TYPE latency histogram
+latency_bucket{le="0.5"} 0
+latency_bucket{le="1"} 1
+latency_bucket{le="+Inf"} 2
+latency_sum 3.7
+latency_count 2
+# TYPE requests_total counter
+requests_total{a="say \"hi\"",b="2"} 3
+`, buffer.String())
+}
+
+var seen = statefun.ValueSpec{
+	Name:      "seen",
+	ValueType: statefun.Int32Type,
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	registry := NewRegistry()
+
+	builder := statefun.StatefulFunctionsBuilder()
+	builder.WithLogger(statefun.NopLogger())
+	builder.WithMetrics(registry)
+
+	function := statefun.TypeNameFrom("org.foo/greeter")
+	err := builder.WithSpec(statefun.StatefulFunctionSpec{
+		FunctionType: function,
+		States:       []statefun.ValueSpec{seen},
+		Function: statefun.StatefulFunctionPointer(func(ctx statefun.Context, msg statefun.Message) error {
+			if msg.AsString() == "fail" {
+				return statefun.Permanent(errors.New("failure"))
+			}
+
+			ctx.Storage().Set(seen, int32(1))
+			ctx.SendEgress(statefun.GenericEgressBuilder{
+				Target:    statefun.TypeNameFrom("org.foo/out"),
+				Value:     msg.AsString(),
+				ValueType: statefun.StringType,
+			})
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	runtime := statefuntest.NewRuntime(builder)
+	address := statefun.Address{FunctionType: function, Id: "0"}
+	for _, value := range []string{"hello", "fail", "world"} {
+		assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: address, Value: value}))
+	}
+	assert.NoError(t, runtime.Run(context.Background()))
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	assert.Contains(t, body, `statefun_invocations_total{function_type="org.foo/greeter"} 3`)
+	assert.Contains(t, body, `statefun_invocation_errors_total{function_type="org.foo/greeter"} 1`)
+	assert.Contains(t, body, `statefun_incomplete_invocation_contexts_total{function_type="org.foo/greeter"} 1`)
+	assert.Contains(t, body, `statefun_egress_messages_total{function_type="org.foo/greeter"} 2`)
+	assert.Contains(t, body, `statefun_batch_size_bucket{function_type="org.foo/greeter",le="5"} 1`)
+	assert.Contains(t, body, `statefun_invocation_duration_seconds_count{function_type="org.foo/greeter"} 3`)
+	assert.Contains(t, body, `statefun_state_written_bytes_total{function_type="org.foo/greeter",state="seen"} 5`)
+}
@@ -0,0 +1,184 @@
+package statefun
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// A TypeRegistry maps the TypeName of a message to the SimpleType
+// that deserializes it and the Go type it is deserialized into, so
+// that messages can be decoded without knowing their type upfront.
+type TypeRegistry struct {
+	mutex sync.RWMutex
+	types map[string]registeredType
+}
+
+type registeredType struct {
+	simpleType SimpleType
+	goType     reflect.Type
+}
+
+// Creates a new, empty TypeRegistry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{types: map[string]registeredType{}}
+}
+
+// Registers the SimpleType, whose values are deserialized into the
+// given Go type. Registering the same TypeName again fails unless
+// it is registered with the same Go type.
+func (r *TypeRegistry) Register(t SimpleType, goType reflect.Type) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	name := t.GetTypeName().String()
+	if registered, exists := r.types[name]; exists && registered.goType != goType {
+		return fmt.Errorf("type %s is already registered as %s", name, registered.goType)
+	}
+
+	r.types[name] = registeredType{simpleType: t, goType: goType}
+	return nil
+}
+
+// Registers the SimpleType, whose values are deserialized into a T.
+//
+//	statefun.RegisterType[GreetRequest](registry, GreetRequestType)
+func RegisterType[T any](registry *TypeRegistry, t SimpleType) error {
+	return registry.Register(t, reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// Returns the SimpleType registered for the TypeName.
+func (r *TypeRegistry) Lookup(typeName TypeName) (SimpleType, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	registered, exists := r.types[typeName.String()]
+	return registered.simpleType, exists
+}
+
+// Deserializes the message's value into a new value of the Go type
+// registered for its TypeName. It returns an error if the message's
+// type is not registered.
+func (r *TypeRegistry) Decode(message Message) (interface{}, error) {
+	value, err := r.decode(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return value.Interface(), nil
+}
+
+func (r *TypeRegistry) decode(message Message) (reflect.Value, error) {
+	r.mutex.RLock()
+	registered, exists := r.types[message.typedValue.Typename]
+	r.mutex.RUnlock()
+
+	if !exists {
+		return reflect.Value{}, fmt.Errorf("unregistered type %s", message.ValueTypeName())
+	}
+
+	// pointer types, such as protobuf messages, are
+	// deserialized into a new value of their element type
+	if registered.goType.Kind() == reflect.Ptr {
+		receiver := reflect.New(registered.goType.Elem())
+		if err := registered.simpleType.Deserialize(bytes.NewReader(message.RawValue()), receiver.Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("failed to deserialize %s: %w", message.ValueTypeName(), err)
+		}
+		return receiver, nil
+	}
+
+	receiver := reflect.New(registered.goType)
+	if err := registered.simpleType.Deserialize(bytes.NewReader(message.RawValue()), receiver.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to deserialize %s: %w", message.ValueTypeName(), err)
+	}
+	return receiver.Elem(), nil
+}
+
+var (
+	contextType = reflect.TypeOf((*Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// A MessageRouter is a StatefulFunction that dispatches each message,
+// by its TypeName, to a handler that receives the deserialized value.
+//
+//	statefun.StatefulFunctionSpec{
+//		FunctionType: GreeterFunc,
+//		Function: statefun.Router().
+//			On(GreetRequestType, func(ctx statefun.Context, request GreetRequest) error {
+//				...
+//			}).
+//			On(statefun.StringType, func(ctx statefun.Context, name string) error {
+//				...
+//			}),
+//	}
+//
+// Messages of a type without a handler fail with a PermanentError,
+// as they can never be processed.
+type MessageRouter struct {
+	registry *TypeRegistry
+	handlers map[string]reflect.Value
+}
+
+// Creates a new MessageRouter without any handlers.
+func Router() *MessageRouter {
+	return RouterWithRegistry(NewTypeRegistry())
+}
+
+// Creates a new MessageRouter that registers the types of its
+// handlers with the given TypeRegistry, so that it may be shared
+// between functions.
+func RouterWithRegistry(registry *TypeRegistry) *MessageRouter {
+	return &MessageRouter{
+		registry: registry,
+		handlers: map[string]reflect.Value{},
+	}
+}
+
+// Registers a handler for messages of the given SimpleType. The
+// handler must be a function of the form func(Context, T) error,
+// where T is the Go type the SimpleType deserializes into. This
+// method panics if the handler is invalid, or if a handler is
+// already registered for the type.
+func (m *MessageRouter) On(t SimpleType, handler interface{}) *MessageRouter {
+	name := t.GetTypeName().String()
+	function := reflect.ValueOf(handler)
+	signature := function.Type()
+
+	if signature.Kind() != reflect.Func ||
+		signature.NumIn() != 2 || signature.In(0) != contextType ||
+		signature.NumOut() != 1 || signature.Out(0) != errorType {
+		panic(fmt.Errorf("handler for %s must be of the form func(statefun.Context, T) error, not %s", name, signature))
+	}
+
+	if _, exists := m.handlers[name]; exists {
+		panic(fmt.Errorf("a handler is already registered for %s", name))
+	}
+
+	if err := m.registry.Register(t, signature.In(1)); err != nil {
+		panic(fmt.Errorf("failed to register handler for %s: %w", name, err))
+	}
+
+	m.handlers[name] = function
+	return m
+}
+
+func (m *MessageRouter) Invoke(ctx Context, message Message) error {
+	handler, exists := m.handlers[message.typedValue.Typename]
+	if !exists {
+		return Permanent(fmt.Errorf("no handler registered for type %s", message.ValueTypeName()))
+	}
+
+	value, err := m.registry.decode(message)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	result := handler.Call([]reflect.Value{reflect.ValueOf(&ctx).Elem(), value})
+	if err, _ := result[0].Interface().(error); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package statefun
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+var greetingTypeName = TypeNameFrom("org.foo/Greeting")
+
+type Greeting struct {
+	Name string `json:"name"`
+}
+
+func routedMessage(t *testing.T, value interface{}, valueType SimpleType) Message {
+	message, err := MessageBuilder{
+		Target:    Address{FunctionType: TypeNameFrom("org.foo/router"), Id: "a"},
+		Value:     value,
+		ValueType: valueType,
+	}.ToMessage()
+	assert.NoError(t, err)
+	return message
+}
+
+func TestRouter(t *testing.T) {
+	greetingType := MakeJsonType(greetingTypeName)
+	protoType := MakeProtobufType(&wrapperspb.StringValue{})
+
+	var received []interface{}
+	router := Router().
+		On(greetingType, func(ctx Context, greeting Greeting) error {
+			received = append(received, greeting)
+			return nil
+		}).
+		On(StringType, func(ctx Context, name string) error {
+			received = append(received, name)
+			return nil
+		}).
+		On(protoType, func(ctx Context, value *wrapperspb.StringValue) error {
+			received = append(received, value.GetValue())
+			return errors.New("failure")
+		})
+
+	ctx := &statefunContext{Context: context.Background()}
+	assert.NoError(t, router.Invoke(ctx, routedMessage(t, Greeting{Name: "bob"}, greetingType)))
+	assert.NoError(t, router.Invoke(ctx, routedMessage(t, "alice", nil)))
+	assert.EqualError(t, router.Invoke(ctx, routedMessage(t, wrapperspb.String("proto"), protoType)), "failure")
+	assert.Equal(t, []interface{}{Greeting{Name: "bob"}, "alice", "proto"}, received)
+
+	err := router.Invoke(ctx, routedMessage(t, int32(1), nil))
+	assert.True(t, errors.As(err, &PermanentError{}), "unregistered types should fail permanently")
+	assert.Contains(t, err.Error(), "io.statefun.types/int")
+}
+
+func TestRouterRejectsInvalidHandlers(t *testing.T) {
+	assert.Panics(t, func() {
+		Router().On(StringType, func(name string) error { return nil })
+	})
+
+	assert.Panics(t, func() {
+		Router().On(StringType, func(ctx Context, name string) {})
+	})
+
+	assert.Panics(t, func() {
+		Router().
+			On(StringType, func(ctx Context, name string) error { return nil }).
+			On(StringType, func(ctx Context, name string) error { return nil })
+	}, "a type may only have one handler")
+}
+
+func TestTypeRegistry(t *testing.T) {
+	greetingType := MakeJsonType(greetingTypeName)
+	registry := NewTypeRegistry()
+	assert.NoError(t, RegisterType[Greeting](registry, greetingType))
+	assert.NoError(t, RegisterType[Greeting](registry, greetingType))
+	assert.Error(t, RegisterType[string](registry, greetingType), "a TypeName cannot map to two Go types")
+
+	registered, ok := registry.Lookup(greetingTypeName)
+	assert.True(t, ok)
+	assert.Equal(t, greetingType, registered)
+
+	value, err := registry.Decode(routedMessage(t, Greeting{Name: "bob"}, greetingType))
+	assert.NoError(t, err)
+	assert.Equal(t, Greeting{Name: "bob"}, value)
+
+	_, err = registry.Decode(routedMessage(t, "bob", nil))
+	assert.EqualError(t, err, "unregistered type io.statefun.types/string")
+}
@@ -1,5 +1,7 @@
 package statefun
 
+import "time"
+
 // A StatefulFunction is a user-defined function that can be invoked with a given input.
 // This is the primitive building block for a Stateful Functions application.
 //
@@ -32,7 +34,8 @@ type StatefulFunction interface {
 	// is canceled as soon as Invoke returns as a signal to
 	// any spawned go routines. The method may return
 	// an Error to signal the invocation failed and should
-	// be reattempted.
+	// be reattempted, or a PermanentError to signal the
+	// message can never be processed and should be discarded.
 	Invoke(ctx Context, message Message) error
 }
 
@@ -50,6 +53,20 @@ type StatefulFunctionSpec struct {
 
 	// The physical StatefulFunction instance.
 	Function StatefulFunction
+
+	// An optional slice of Interceptor's applied to every
+	// invocation of this function, after those registered
+	// on the StatefulFunctions registry.
+	Interceptors []Interceptor
+
+	// An optional bound on the duration of each invocation
+	// of this function, which sets the Deadline of its
+	// Context. An invocation that exceeds it fails the batch
+	// with a TimeoutError, even if the function does not
+	// observe its Context; in that case the goroutine running
+	// it is leaked until it returns, and its side effects are
+	// discarded. By default, it is not bounded.
+	Timeout time.Duration
 }
 
 // The StatefulFunctionPointer type is an adapter to allow the use of
@@ -61,3 +78,31 @@ type StatefulFunctionPointer func(Context, Message) error
 func (s StatefulFunctionPointer) Invoke(ctx Context, message Message) error {
 	return s(ctx, message)
 }
+
+// An Interceptor wraps the invocation of a StatefulFunction,
+// in the same style as net/http middleware. It observes the
+// Context and Message on the way in and the error on the way
+// out, and may short-circuit the invocation by returning
+// without calling next.
+//
+//	func Audit(next StatefulFunction) StatefulFunction {
+//		return StatefulFunctionPointer(func(ctx Context, message Message) error {
+//			err := next.Invoke(ctx, message)
+//			ctx.Logger().Info("invoked", "error", err)
+//			return err
+//		})
+//	}
+type Interceptor func(next StatefulFunction) StatefulFunction
+
+// Wraps the function with the given interceptors. The
+// first Interceptor is the outermost, so it is the first
+// to observe each invocation.
+func intercept(function StatefulFunction, interceptors ...[]Interceptor) StatefulFunction {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		for j := len(interceptors[i]) - 1; j >= 0; j-- {
+			function = interceptors[i][j](function)
+		}
+	}
+
+	return function
+}
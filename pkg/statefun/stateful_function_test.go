@@ -0,0 +1,101 @@
+package statefun
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func recordInterceptor(name string, calls *[]string) Interceptor {
+	return func(next StatefulFunction) StatefulFunction {
+		return StatefulFunctionPointer(func(ctx Context, message Message) error {
+			*calls = append(*calls, name+" before "+message.AsString())
+			err := next.Invoke(ctx, message)
+			*calls = append(*calls, name+" after")
+			return err
+		})
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+
+	builder := StatefulFunctionsBuilder()
+	builder.WithInterceptors(recordInterceptor("global", &calls))
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, message Message) error {
+			calls = append(calls, "function")
+			return nil
+		}),
+		Interceptors: []Interceptor{recordInterceptor("spec", &calls)},
+	})
+	assert.NoError(t, err)
+
+	response, _ := invokeBatch(t, builder, "a", "b")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	assert.Equal(t, []string{
+		"global before a", "spec before a", "function", "spec after", "global after",
+		"global before b", "spec before b", "function", "spec after", "global after",
+	}, calls)
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	denied := errors.New("unauthorized")
+
+	builder := StatefulFunctionsBuilder()
+	builder.WithInterceptors(func(next StatefulFunction) StatefulFunction {
+		return StatefulFunctionPointer(func(ctx Context, message Message) error {
+			if message.AsString() == "intruder" {
+				return Permanent(denied)
+			}
+			return next.Invoke(ctx, message)
+		})
+	})
+
+	invoked := 0
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, message Message) error {
+			invoked++
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	response, _ := invokeBatch(t, builder, "friend", "intruder")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 1, invoked)
+}
+
+func TestInterceptorChainIsBuiltOnce(t *testing.T) {
+	var calls []string
+
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, message Message) error {
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	wrapped := 0
+	builder.WithInterceptors(func(next StatefulFunction) StatefulFunction {
+		wrapped++
+		return recordInterceptor("global", &calls)(next)
+	})
+
+	for i := 0; i < 3; i++ {
+		response, _ := invokeBatch(t, builder, "a")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+
+	assert.Equal(t, 1, wrapped, "the interceptor chain should be built once")
+	assert.Len(t, calls, 6, "interceptors registered after the spec should apply")
+}
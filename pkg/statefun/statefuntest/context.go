@@ -0,0 +1,130 @@
+package statefuntest
+
+import (
+	"context"
+	"statefun-sdk-go/pkg/statefun"
+	"sync"
+	"time"
+)
+
+// A DelayedMessage is a message passed to Context.SendAfter
+// along with its requested delay.
+type DelayedMessage struct {
+	Delay   time.Duration
+	Message statefun.MessageBuilder
+}
+
+// Context is a recording statefun.Context. Every side effect
+// requested by a function is stored as-is so tests can assert
+// on the typed values, without going through the wire protocol.
+//
+// The recorded side effects are cleared at the beginning of
+// each call to Invoke.
+type Context struct {
+	sync.Mutex
+	context.Context
+	parent  context.Context
+	self    statefun.Address
+	caller  *statefun.Address
+	storage *Storage
+	logger  statefun.Logger
+
+	// Messages passed to Send.
+	Messages []statefun.MessageBuilder
+
+	// Messages passed to SendAfter.
+	DelayedMessages []DelayedMessage
+
+	// Egress records passed to SendEgress.
+	Egresses []statefun.EgressBuilder
+}
+
+// Creates a new Context for the function instance identified
+// by self, backed by the given Storage. If storage is nil,
+// an empty Storage without any registered values is used.
+func NewContext(self statefun.Address, storage *Storage) *Context {
+	if storage == nil {
+		storage = NewStorage()
+	}
+
+	return &Context{
+		Context: context.Background(),
+		parent:  context.Background(),
+		self:    self,
+		storage: storage,
+		logger:  statefun.NopLogger(),
+	}
+}
+
+// Sets the caller Address observed by the function
+// on subsequent invocations.
+func (c *Context) WithCaller(caller statefun.Address) *Context {
+	c.caller = &caller
+	return c
+}
+
+// Sets the Logger returned by Logger. By
+// default, all log events are discarded.
+func (c *Context) WithLogger(logger statefun.Logger) *Context {
+	c.logger = logger
+	return c
+}
+
+func (c *Context) Self() statefun.Address {
+	return c.self
+}
+
+func (c *Context) Caller() *statefun.Address {
+	return c.caller
+}
+
+func (c *Context) Storage() statefun.AddressScopedStorage {
+	return c.storage
+}
+
+func (c *Context) Logger() statefun.Logger {
+	if c.caller == nil {
+		return c.logger.With("self", c.self.String())
+	}
+
+	return c.logger.With("self", c.self.String(), "caller", c.caller.String())
+}
+
+func (c *Context) Send(message statefun.MessageBuilder) {
+	if _, err := message.ToMessage(); err != nil {
+		panic(err)
+	}
+
+	c.Lock()
+	c.Messages = append(c.Messages, message)
+	c.Unlock()
+}
+
+func (c *Context) SendAfter(delay time.Duration, message statefun.MessageBuilder) {
+	if _, err := message.ToMessage(); err != nil {
+		panic(err)
+	}
+
+	c.Lock()
+	c.DelayedMessages = append(c.DelayedMessages, DelayedMessage{
+		Delay:   delay,
+		Message: message,
+	})
+	c.Unlock()
+}
+
+func (c *Context) SendEgress(egress statefun.EgressBuilder) {
+	c.Lock()
+	c.Egresses = append(c.Egresses, egress)
+	c.Unlock()
+}
+
+func (c *Context) reset() {
+	c.Lock()
+	c.Messages = nil
+	c.DelayedMessages = nil
+	c.Egresses = nil
+	c.Unlock()
+
+	c.storage.resetMutations()
+}
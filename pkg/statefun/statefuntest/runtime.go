@@ -0,0 +1,454 @@
+package statefuntest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"statefun-sdk-go/pkg/statefun"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"time"
+)
+
+// Runtime is a local, in-memory emulation of the Stateful Functions
+// runtime. It drives the registered functions through a
+// RequestReplyHandler using the same request-reply protocol as a
+// Flink cluster, which makes it possible to test entire function
+// graphs with go test.
+//
+// Messages sent to functions are delivered in order, batched per
+// target Address. State is held in memory for each Address and is
+// updated from the state mutations returned by each batch. Values a
+// function has not yet received are registered the way the runtime
+// would, by answering an incomplete invocation context with the
+// missing specs. Delayed messages fire on a virtual clock that is
+// only moved forward by Advance.
+//
+// State expiration is not emulated. A Runtime is not safe
+// for concurrent use.
+type Runtime struct {
+	handler  statefun.RequestReplyHandler
+	now      time.Duration
+	sequence int
+	mailbox  []*envelope
+	delayed  []*delayedEnvelope
+	specs    map[string]map[string]*protocol.FromFunction_PersistedValueSpec
+	state    map[string]map[string]*protocol.TypedValue
+	egresses []EgressRecord
+}
+
+type envelope struct {
+	target   *protocol.Address
+	caller   *protocol.Address
+	argument *protocol.TypedValue
+}
+
+type delayedEnvelope struct {
+	*envelope
+	fireAt   time.Duration
+	sequence int
+}
+
+// Creates a new Runtime for the functions registered
+// in the given StatefulFunctions registry.
+func NewRuntime(functions statefun.StatefulFunctions) *Runtime {
+	return NewRuntimeFromHandler(functions.AsHandler())
+}
+
+// Creates a new Runtime that invokes functions
+// through the given RequestReplyHandler.
+func NewRuntimeFromHandler(handler statefun.RequestReplyHandler) *Runtime {
+	return &Runtime{
+		handler: handler,
+		specs:   map[string]map[string]*protocol.FromFunction_PersistedValueSpec{},
+		state:   map[string]map[string]*protocol.TypedValue{},
+	}
+}
+
+// Enqueues a message as if it were routed from an ingress.
+// The message is delivered on the next call to Run or Advance.
+func (r *Runtime) Send(message statefun.MessageBuilder) error {
+	env, err := toEnvelope(message)
+	if err != nil {
+		return err
+	}
+
+	r.mailbox = append(r.mailbox, env)
+	return nil
+}
+
+// Enqueues a message as if it were routed from an ingress, to be
+// delivered once the virtual clock has advanced by delay.
+func (r *Runtime) SendAfter(delay time.Duration, message statefun.MessageBuilder) error {
+	env, err := toEnvelope(message)
+	if err != nil {
+		return err
+	}
+
+	r.schedule(delay, env)
+	return nil
+}
+
+// Delivers all pending messages, including any messages sent by
+// the invoked functions, until no more messages are pending.
+// Delayed messages are only delivered once they are due, see Advance.
+//
+// If a function fails, or returns side effects the runtime would
+// reject, such as an egress record with a malformed TypeName, the
+// failed batch is returned to the front of the mailbox and the error
+// is returned; a subsequent call to Run will retry the batch, just
+// as the runtime would.
+func (r *Runtime) Run(ctx context.Context) error {
+	for len(r.mailbox) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		target := r.mailbox[0].target
+		var batch, remaining []*envelope
+		for _, env := range r.mailbox {
+			if proto.Equal(env.target, target) {
+				batch = append(batch, env)
+			} else {
+				remaining = append(remaining, env)
+			}
+		}
+
+		r.mailbox = remaining
+		if err := r.deliver(ctx, target, batch); err != nil {
+			r.mailbox = append(batch, r.mailbox...)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Moves the virtual clock forward by the given duration, delivering
+// each delayed message as it comes due along with any messages
+// sent as a result.
+func (r *Runtime) Advance(ctx context.Context, duration time.Duration) error {
+	deadline := r.now + duration
+
+	for len(r.delayed) > 0 && r.delayed[0].fireAt <= deadline {
+		next := r.delayed[0]
+		r.delayed = r.delayed[1:]
+
+		r.now = next.fireAt
+		r.mailbox = append(r.mailbox, next.envelope)
+
+		if err := r.Run(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.now = deadline
+	return r.Run(ctx)
+}
+
+// Returns the amount of virtual time that has
+// elapsed since the Runtime was created.
+func (r *Runtime) Elapsed() time.Duration {
+	return r.now
+}
+
+// Returns all records sent to egresses so far, in order.
+func (r *Runtime) Egresses() []EgressRecord {
+	egresses := make([]EgressRecord, len(r.egresses))
+	copy(egresses, r.egresses)
+	return egresses
+}
+
+// Gets the current value of the provided ValueSpec for the function
+// instance at the given Address and stores the result in the value
+// pointed to by receiver. Returns false if there is no value.
+func (r *Runtime) State(address statefun.Address, spec statefun.ValueSpec, receiver interface{}) bool {
+	value, exists := r.state[addressKey(toInternal(address))][spec.Name]
+	if !exists || !value.HasValue {
+		return false
+	}
+
+	if err := spec.ValueType.Deserialize(bytes.NewReader(value.Value), receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize %s: %w", spec.Name, err))
+	}
+
+	return true
+}
+
+func (r *Runtime) deliver(ctx context.Context, target *protocol.Address, batch []*envelope) error {
+	invocations := make([]*protocol.ToFunction_Invocation, 0, len(batch))
+	for _, env := range batch {
+		invocations = append(invocations, &protocol.ToFunction_Invocation{
+			Caller:   env.caller,
+			Argument: env.argument,
+		})
+	}
+
+	// the first attempt may be missing specs the runtime has not yet
+	// seen; once they are registered the second attempt must succeed
+	for attempt := 0; attempt < 2; attempt++ {
+		from, err := r.invoke(ctx, target, invocations)
+		if err != nil {
+			return err
+		}
+
+		if incomplete := from.GetIncompleteInvocationContext(); incomplete != nil {
+			r.register(target, incomplete.MissingValues)
+			continue
+		}
+
+		result := from.GetInvocationResult()
+		if result == nil {
+			return fmt.Errorf("function %s/%s returned an empty response", target.Namespace, target.Type)
+		}
+
+		return r.apply(target, result)
+	}
+
+	return fmt.Errorf("function %s/%s requested missing state values after they were registered", target.Namespace, target.Type)
+}
+
+func (r *Runtime) invoke(ctx context.Context, target *protocol.Address, invocations []*protocol.ToFunction_Invocation) (*protocol.FromFunction, error) {
+	specs := r.specs[functionTypeKey(target)]
+	values := r.state[addressKey(target)]
+
+	state := make([]*protocol.ToFunction_PersistedValue, 0, len(specs))
+	for name, spec := range specs {
+		value, exists := values[name]
+		if !exists {
+			value = &protocol.TypedValue{Typename: spec.TypeTypename}
+		}
+
+		state = append(state, &protocol.ToFunction_PersistedValue{
+			StateName:  name,
+			StateValue: proto.Clone(value).(*protocol.TypedValue),
+		})
+	}
+
+	toFunction := &protocol.ToFunction{
+		Request: &protocol.ToFunction_Invocation_{
+			Invocation: &protocol.ToFunction_InvocationBatchRequest{
+				Target:      target,
+				State:       state,
+				Invocations: invocations,
+			},
+		},
+	}
+
+	payload, err := proto.Marshal(toFunction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ToFunction: %w", err)
+	}
+
+	response, err := r.handler.Invoke(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	from := &protocol.FromFunction{}
+	if err := proto.Unmarshal(response, from); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal FromFunction: %w", err)
+	}
+
+	return from, nil
+}
+
+func (r *Runtime) register(target *protocol.Address, missing []*protocol.FromFunction_PersistedValueSpec) {
+	key := functionTypeKey(target)
+	specs, exists := r.specs[key]
+	if !exists {
+		specs = map[string]*protocol.FromFunction_PersistedValueSpec{}
+		r.specs[key] = specs
+	}
+
+	for _, spec := range missing {
+		specs[spec.StateName] = spec
+	}
+}
+
+// Applies the side effects of a batch. The egress records are
+// validated first, so that a batch is either applied in full or,
+// if it fails, not at all and may be retried.
+func (r *Runtime) apply(target *protocol.Address, result *protocol.FromFunction_InvocationResponse) error {
+	egresses := make([]EgressRecord, 0, len(result.OutgoingEgresses))
+	for _, egress := range result.OutgoingEgresses {
+		name, err := statefun.TypeNameFromParts(egress.EgressNamespace, egress.EgressType)
+		if err != nil {
+			return fmt.Errorf("function %s/%s sent a record to an invalid egress: %w", target.Namespace, target.Type, err)
+		}
+
+		valueTypeName, err := statefun.ParseTypeName(egress.GetArgument().GetTypename())
+		if err != nil {
+			return fmt.Errorf("function %s/%s sent an egress record with an invalid type: %w", target.Namespace, target.Type, err)
+		}
+
+		egresses = append(egresses, EgressRecord{
+			Target:        name,
+			ValueTypeName: valueTypeName,
+			Value:         egress.Argument.Value,
+		})
+	}
+
+	key := addressKey(target)
+	values, exists := r.state[key]
+	if !exists {
+		values = map[string]*protocol.TypedValue{}
+		r.state[key] = values
+	}
+
+	for _, mutation := range result.StateMutations {
+		switch mutation.MutationType {
+		case protocol.FromFunction_PersistedValueMutation_MODIFY:
+			values[mutation.StateName] = mutation.StateValue
+		case protocol.FromFunction_PersistedValueMutation_DELETE:
+			delete(values, mutation.StateName)
+		}
+	}
+
+	for _, invocation := range result.OutgoingMessages {
+		r.mailbox = append(r.mailbox, &envelope{
+			target:   invocation.Target,
+			caller:   target,
+			argument: invocation.Argument,
+		})
+	}
+
+	for _, invocation := range result.DelayedInvocations {
+		r.schedule(time.Duration(invocation.DelayInMs)*time.Millisecond, &envelope{
+			target:   invocation.Target,
+			caller:   target,
+			argument: invocation.Argument,
+		})
+	}
+
+	r.egresses = append(r.egresses, egresses...)
+	return nil
+}
+
+func (r *Runtime) schedule(delay time.Duration, env *envelope) {
+	r.sequence++
+	r.delayed = append(r.delayed, &delayedEnvelope{
+		envelope: env,
+		fireAt:   r.now + delay,
+		sequence: r.sequence,
+	})
+
+	sort.Slice(r.delayed, func(i, j int) bool {
+		if r.delayed[i].fireAt == r.delayed[j].fireAt {
+			return r.delayed[i].sequence < r.delayed[j].sequence
+		}
+		return r.delayed[i].fireAt < r.delayed[j].fireAt
+	})
+}
+
+func toEnvelope(message statefun.MessageBuilder) (*envelope, error) {
+	msg, err := message.ToMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	return &envelope{
+		target: toInternal(message.Target),
+		argument: &protocol.TypedValue{
+			Typename: msg.ValueTypeName().String(),
+			HasValue: true,
+			Value:    msg.RawValue(),
+		},
+	}, nil
+}
+
+func toInternal(address statefun.Address) *protocol.Address {
+	return &protocol.Address{
+		Namespace: address.FunctionType.GetNamespace(),
+		Type:      address.FunctionType.GetType(),
+		Id:        address.Id,
+	}
+}
+
+func functionTypeKey(address *protocol.Address) string {
+	return address.Namespace + "/" + address.Type
+}
+
+func addressKey(address *protocol.Address) string {
+	return address.Namespace + "/" + address.Type + "/" + address.Id
+}
+
+const (
+	kafkaProducerRecordTypeName = "type.googleapis.com/io.statefun.sdk.egress.KafkaProducerRecord"
+	kinesisEgressRecordTypeName = "type.googleapis.com/io.statefun.sdk.egress.KinesisEgressRecord"
+)
+
+// An EgressRecord is a message a function sent to an egress.
+type EgressRecord struct {
+	// The TypeName of the egress.
+	Target statefun.TypeName
+
+	// The TypeName of the serialized value.
+	ValueTypeName statefun.TypeName
+
+	// The serialized value.
+	Value []byte
+}
+
+// Deserializes the record's value with the given SimpleType.
+func (e EgressRecord) As(t statefun.SimpleType, receiver interface{}) error {
+	return t.Deserialize(bytes.NewReader(e.Value), receiver)
+}
+
+// A KafkaRecord is an EgressRecord that was
+// created with a statefun.KafkaEgressBuilder.
+type KafkaRecord struct {
+	Topic string
+	Key   string
+	Value []byte
+}
+
+// Decodes the record as a KafkaRecord. Returns an error if the
+// record was not created with a statefun.KafkaEgressBuilder.
+func (e EgressRecord) AsKafkaRecord() (KafkaRecord, error) {
+	if e.ValueTypeName.String() != kafkaProducerRecordTypeName {
+		return KafkaRecord{}, errors.New("egress record is not a Kafka record")
+	}
+
+	record := protocol.KafkaProducerRecord{}
+	if err := proto.Unmarshal(e.Value, &record); err != nil {
+		return KafkaRecord{}, err
+	}
+
+	return KafkaRecord{
+		Topic: record.Topic,
+		Key:   record.Key,
+		Value: record.ValueBytes,
+	}, nil
+}
+
+// A KinesisRecord is an EgressRecord that was
+// created with a statefun.KinesisEgressBuilder.
+type KinesisRecord struct {
+	Stream          string
+	PartitionKey    string
+	ExplicitHashKey string
+	Value           []byte
+}
+
+// Decodes the record as a KinesisRecord. Returns an error if the
+// record was not created with a statefun.KinesisEgressBuilder.
+func (e EgressRecord) AsKinesisRecord() (KinesisRecord, error) {
+	if e.ValueTypeName.String() != kinesisEgressRecordTypeName {
+		return KinesisRecord{}, errors.New("egress record is not a Kinesis record")
+	}
+
+	record := protocol.KinesisEgressRecord{}
+	if err := proto.Unmarshal(e.Value, &record); err != nil {
+		return KinesisRecord{}, err
+	}
+
+	return KinesisRecord{
+		Stream:          record.Stream,
+		PartitionKey:    record.PartitionKey,
+		ExplicitHashKey: record.ExplicitHashKey,
+		Value:           record.ValueBytes,
+	}, nil
+}
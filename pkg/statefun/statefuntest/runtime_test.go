@@ -0,0 +1,191 @@
+package statefuntest
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"statefun-sdk-go/pkg/statefun"
+	"testing"
+	"time"
+)
+
+var (
+	counterType = statefun.TypeNameFrom("org.foo/counter")
+	relayType   = statefun.TypeNameFrom("org.foo/relay")
+	egressType  = statefun.TypeNameFrom("org.foo/out")
+)
+
+var Count = statefun.ValueSpec{
+	Name:      "count",
+	ValueType: statefun.Int64Type,
+}
+
+func counter(ctx statefun.Context, msg statefun.Message) error {
+	var count int64
+	ctx.Storage().Get(Count, &count)
+	count += msg.AsInt64()
+	ctx.Storage().Set(Count, count)
+
+	ctx.SendEgress(statefun.GenericEgressBuilder{
+		Target:    egressType,
+		Value:     count,
+		ValueType: statefun.Int64Type,
+	})
+
+	return nil
+}
+
+func relay(ctx statefun.Context, msg statefun.Message) error {
+	target := statefun.Address{
+		FunctionType: counterType,
+		Id:           ctx.Self().Id,
+	}
+
+	ctx.Send(statefun.MessageBuilder{Target: target, Value: int64(1)})
+	ctx.SendAfter(time.Minute, statefun.MessageBuilder{Target: target, Value: int64(10)})
+
+	return nil
+}
+
+func newTestRuntime(t *testing.T, counterFn statefun.StatefulFunctionPointer) *Runtime {
+	functions := statefun.StatefulFunctionsBuilder()
+	assert.NoError(t, functions.WithSpec(statefun.StatefulFunctionSpec{
+		FunctionType: counterType,
+		States:       []statefun.ValueSpec{Count},
+		Function:     counterFn,
+	}))
+
+	assert.NoError(t, functions.WithSpec(statefun.StatefulFunctionSpec{
+		FunctionType: relayType,
+		Function:     statefun.StatefulFunctionPointer(relay),
+	}))
+
+	return NewRuntime(functions)
+}
+
+func egressValues(t *testing.T, runtime *Runtime) []int64 {
+	var values []int64
+	for _, record := range runtime.Egresses() {
+		var value int64
+		assert.NoError(t, record.As(statefun.Int64Type, &value))
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func TestRuntimeRoutesMessages(t *testing.T) {
+	runtime := newTestRuntime(t, counter)
+	ctx := context.Background()
+
+	self := statefun.Address{FunctionType: relayType, Id: "a"}
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: self, Value: "go"}))
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: self, Value: "go"}))
+	assert.NoError(t, runtime.Run(ctx))
+
+	assert.Equal(t, []int64{1, 2}, egressValues(t, runtime))
+
+	var count int64
+	address := statefun.Address{FunctionType: counterType, Id: "a"}
+	assert.True(t, runtime.State(address, Count, &count))
+	assert.Equal(t, int64(2), count)
+}
+
+func TestRuntimeDelayedMessages(t *testing.T) {
+	runtime := newTestRuntime(t, counter)
+	ctx := context.Background()
+
+	self := statefun.Address{FunctionType: relayType, Id: "a"}
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: self, Value: "go"}))
+	assert.NoError(t, runtime.Run(ctx))
+	assert.Equal(t, []int64{1}, egressValues(t, runtime))
+
+	assert.NoError(t, runtime.Advance(ctx, 59*time.Second))
+	assert.Equal(t, []int64{1}, egressValues(t, runtime))
+
+	assert.NoError(t, runtime.Advance(ctx, time.Second))
+	assert.Equal(t, []int64{1, 11}, egressValues(t, runtime))
+	assert.Equal(t, time.Minute, runtime.Elapsed())
+}
+
+func TestRuntimeRetriesFailedBatch(t *testing.T) {
+	fail := true
+	runtime := newTestRuntime(t, func(ctx statefun.Context, msg statefun.Message) error {
+		if fail {
+			return errors.New("failure")
+		}
+		return counter(ctx, msg)
+	})
+
+	ctx := context.Background()
+	address := statefun.Address{FunctionType: counterType, Id: "a"}
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: address, Value: int64(5)}))
+
+	assert.Error(t, runtime.Run(ctx))
+	assert.Empty(t, runtime.Egresses())
+
+	fail = false
+	assert.NoError(t, runtime.Run(ctx))
+	assert.Equal(t, []int64{5}, egressValues(t, runtime))
+}
+
+func TestRuntimeRemovesState(t *testing.T) {
+	runtime := newTestRuntime(t, func(ctx statefun.Context, msg statefun.Message) error {
+		if msg.AsInt64() < 0 {
+			ctx.Storage().Remove(Count)
+			return nil
+		}
+		return counter(ctx, msg)
+	})
+
+	ctx := context.Background()
+	address := statefun.Address{FunctionType: counterType, Id: "a"}
+
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: address, Value: int64(5)}))
+	assert.NoError(t, runtime.Run(ctx))
+
+	var count int64
+	assert.True(t, runtime.State(address, Count, &count))
+
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: address, Value: int64(-1)}))
+	assert.NoError(t, runtime.Run(ctx))
+	assert.False(t, runtime.State(address, Count, &count))
+}
+
+// a TypeName that does not conform to the <namespace>/<name> format
+type malformedTypeName struct{}
+
+func (malformedTypeName) String() string       { return "malformed" }
+func (malformedTypeName) GetNamespace() string { return "" }
+func (malformedTypeName) GetType() string      { return "malformed" }
+
+type malformedType struct {
+	statefun.PrimitiveType
+}
+
+func (malformedType) GetTypeName() statefun.TypeName {
+	return malformedTypeName{}
+}
+
+func TestRuntimeRejectsInvalidEgressRecords(t *testing.T) {
+	runtime := newTestRuntime(t, func(ctx statefun.Context, msg statefun.Message) error {
+		ctx.Storage().Set(Count, msg.AsInt64())
+		ctx.SendEgress(statefun.GenericEgressBuilder{
+			Target:    egressType,
+			Value:     msg.AsInt64(),
+			ValueType: malformedType{statefun.Int64Type},
+		})
+		return nil
+	})
+
+	ctx := context.Background()
+	address := statefun.Address{FunctionType: counterType, Id: "a"}
+	assert.NoError(t, runtime.Send(statefun.MessageBuilder{Target: address, Value: int64(5)}))
+
+	err := runtime.Run(ctx)
+	assert.ErrorContains(t, err, "invalid type")
+	assert.Empty(t, runtime.Egresses())
+
+	var count int64
+	assert.False(t, runtime.State(address, Count, &count), "a batch that fails to apply should not modify state")
+}
@@ -0,0 +1,45 @@
+// Package statefuntest provides utilities for testing
+// StatefulFunction's in-process, without a running
+// Stateful Functions cluster or the wire protocol.
+//
+//	storage := statefuntest.NewStorage(Seen)
+//	ctx := statefuntest.NewContext(self, storage)
+//
+//	err := statefuntest.Invoke(greeter, ctx, statefun.MessageBuilder{Value: "Hello"})
+//
+//	// assert on ctx.Messages, ctx.DelayedMessages,
+//	// ctx.Egresses, and storage.Mutations()
+package statefuntest
+
+import (
+	"context"
+	"statefun-sdk-go/pkg/statefun"
+)
+
+// Invokes the function with the given message using the
+// recording Context. If the message does not specify a Target,
+// it is addressed to the Context's Self. Side effects and
+// state mutations recorded by a previous invocation are
+// cleared before the function is called, while state values
+// are retained across invocations.
+//
+// Just like the SDK's handler, the Context is canceled
+// as soon as the function returns.
+func Invoke(function statefun.StatefulFunction, ctx *Context, message statefun.MessageBuilder) error {
+	if message.Target == (statefun.Address{}) {
+		message.Target = ctx.self
+	}
+
+	msg, err := message.ToMessage()
+	if err != nil {
+		return err
+	}
+
+	ctx.reset()
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithCancel(ctx.parent)
+	defer cancel()
+
+	return function.Invoke(ctx, msg)
+}
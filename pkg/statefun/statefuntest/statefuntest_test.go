@@ -0,0 +1,141 @@
+package statefuntest
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"statefun-sdk-go/pkg/statefun"
+	"testing"
+	"time"
+)
+
+var Seen = statefun.ValueSpec{
+	Name:      "seen",
+	ValueType: statefun.Int32Type,
+}
+
+var self = statefun.Address{
+	FunctionType: statefun.TypeNameFrom("org.foo/greeter"),
+	Id:           "0",
+}
+
+func greeter(ctx statefun.Context, msg statefun.Message) error {
+	if !msg.IsString() {
+		return errors.New("expected a string")
+	}
+
+	var seen int32
+	ctx.Storage().Get(Seen, &seen)
+	seen += 1
+	ctx.Storage().Set(Seen, seen)
+
+	ctx.Send(statefun.MessageBuilder{
+		Target: statefun.Address{
+			FunctionType: statefun.TypeNameFrom("org.foo/greeter-java"),
+			Id:           msg.AsString(),
+		},
+		Value: seen,
+	})
+
+	ctx.SendAfter(time.Hour, statefun.MessageBuilder{
+		Target: *ctx.Caller(),
+		Value:  "hoo hoo",
+	})
+
+	ctx.SendEgress(statefun.KafkaEgressBuilder{
+		Target: statefun.TypeNameFrom("e/kafka"),
+		Topic:  "out",
+		Key:    "abc",
+		Value:  seen,
+	})
+
+	return nil
+}
+
+func TestInvoke(t *testing.T) {
+	caller := statefun.Address{
+		FunctionType: statefun.TypeNameFrom("night/owl"),
+		Id:           "1",
+	}
+
+	storage := NewStorage(Seen)
+	ctx := NewContext(self, storage).WithCaller(caller)
+
+	err := Invoke(statefun.StatefulFunctionPointer(greeter), ctx, statefun.MessageBuilder{Value: "bob"})
+	assert.NoError(t, err)
+
+	assert.Len(t, ctx.Messages, 1)
+	assert.Equal(t, "bob", ctx.Messages[0].Target.Id)
+	assert.Equal(t, int32(1), ctx.Messages[0].Value)
+
+	assert.Len(t, ctx.DelayedMessages, 1)
+	assert.Equal(t, time.Hour, ctx.DelayedMessages[0].Delay)
+	assert.Equal(t, caller, ctx.DelayedMessages[0].Message.Target)
+
+	assert.Len(t, ctx.Egresses, 1)
+	assert.Equal(t, "out", ctx.Egresses[0].(statefun.KafkaEgressBuilder).Topic)
+
+	assert.Equal(t, []StateMutation{{Name: "seen"}}, storage.Mutations())
+
+	var seen int32
+	assert.True(t, storage.Get(Seen, &seen))
+	assert.Equal(t, int32(1), seen)
+}
+
+func TestInvokeClearsSideEffects(t *testing.T) {
+	storage := NewStorage(Seen)
+	ctx := NewContext(self, storage).WithCaller(self)
+
+	for i := 0; i < 3; i++ {
+		err := Invoke(statefun.StatefulFunctionPointer(greeter), ctx, statefun.MessageBuilder{Value: "bob"})
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, ctx.Messages, 1)
+	assert.Equal(t, int32(3), ctx.Messages[0].Value)
+	assert.Len(t, storage.Mutations(), 1)
+}
+
+func TestContextCanceledAfterInvoke(t *testing.T) {
+	ctx := NewContext(self, nil)
+
+	var done <-chan struct{}
+	err := Invoke(statefun.StatefulFunctionPointer(func(ctx statefun.Context, _ statefun.Message) error {
+		done = ctx.Done()
+		return nil
+	}), ctx, statefun.MessageBuilder{Value: "bob"})
+
+	assert.NoError(t, err)
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("context should be canceled once the function returns")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	storage := NewStorage(Seen)
+	storage.Set(Seen, int32(5))
+
+	ctx := NewContext(self, storage)
+	err := Invoke(statefun.StatefulFunctionPointer(func(ctx statefun.Context, _ statefun.Message) error {
+		ctx.Storage().Remove(Seen)
+		return nil
+	}), ctx, statefun.MessageBuilder{Value: "bob"})
+
+	assert.NoError(t, err)
+	assert.True(t, storage.Mutated(Seen))
+	assert.Equal(t, []StateMutation{{Name: "seen", Removed: true}}, storage.Mutations())
+
+	var seen int32
+	assert.False(t, storage.Get(Seen, &seen))
+}
+
+func TestUnregisteredValueSpec(t *testing.T) {
+	storage := NewStorage()
+
+	var seen int32
+	assert.Panics(t, func() {
+		storage.Get(Seen, &seen)
+	})
+}
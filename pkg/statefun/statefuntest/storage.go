@@ -0,0 +1,125 @@
+package statefuntest
+
+import (
+	"bytes"
+	"fmt"
+	"statefun-sdk-go/pkg/statefun"
+	"sync"
+)
+
+// A StateMutation records a change made to a
+// persisted value during the most recent invocation.
+type StateMutation struct {
+	// The name of the mutated ValueSpec.
+	Name string
+
+	// True if the value was removed, false if it was set.
+	Removed bool
+}
+
+// Storage is an in-memory statefun.AddressScopedStorage. Values are
+// serialized with the ValueSpec's SimpleType exactly as they would be
+// by the runtime, so functions observe the same encoding errors they
+// would in production. Like the SDK's storage, accessing a ValueSpec
+// that was not registered with NewStorage panics.
+type Storage struct {
+	mutex     sync.RWMutex
+	specs     map[string]statefun.ValueSpec
+	values    map[string][]byte
+	mutations []StateMutation
+}
+
+// Creates a new Storage with the given registered ValueSpec's.
+func NewStorage(specs ...statefun.ValueSpec) *Storage {
+	s := &Storage{
+		specs:  make(map[string]statefun.ValueSpec, len(specs)),
+		values: make(map[string][]byte, len(specs)),
+	}
+
+	for _, spec := range specs {
+		s.specs[spec.Name] = spec
+	}
+
+	return s
+}
+
+func (s *Storage) Get(spec statefun.ValueSpec, receiver interface{}) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	s.checkRegistered(spec)
+
+	value, exists := s.values[spec.Name]
+	if !exists {
+		return false
+	}
+
+	if err := spec.ValueType.Deserialize(bytes.NewReader(value), receiver); err != nil {
+		panic(fmt.Errorf("failed to deserialize %s: %w", spec.Name, err))
+	}
+
+	return true
+}
+
+func (s *Storage) Set(spec statefun.ValueSpec, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkRegistered(spec)
+
+	buffer := bytes.Buffer{}
+	if err := spec.ValueType.Serialize(&buffer, value); err != nil {
+		panic(fmt.Errorf("failed to serialize %s: %w", spec.Name, err))
+	}
+
+	s.values[spec.Name] = buffer.Bytes()
+	s.mutations = append(s.mutations, StateMutation{Name: spec.Name})
+}
+
+func (s *Storage) Remove(spec statefun.ValueSpec) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkRegistered(spec)
+
+	delete(s.values, spec.Name)
+	s.mutations = append(s.mutations, StateMutation{Name: spec.Name, Removed: true})
+}
+
+// Returns the mutations made since the last call to
+// Invoke, in the order they were applied.
+func (s *Storage) Mutations() []StateMutation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	mutations := make([]StateMutation, len(s.mutations))
+	copy(mutations, s.mutations)
+	return mutations
+}
+
+// Returns true if the value for the given ValueSpec
+// was set or removed since the last call to Invoke.
+func (s *Storage) Mutated(spec statefun.ValueSpec) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, mutation := range s.mutations {
+		if mutation.Name == spec.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Storage) resetMutations() {
+	s.mutex.Lock()
+	s.mutations = nil
+	s.mutex.Unlock()
+}
+
+func (s *Storage) checkRegistered(spec statefun.ValueSpec) {
+	if _, ok := s.specs[spec.Name]; !ok {
+		panic(fmt.Errorf("unregistered ValueSpec %s", spec.Name))
+	}
+}
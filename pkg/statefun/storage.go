@@ -2,6 +2,7 @@ package statefun
 
 import (
 	"fmt"
+	"io/ioutil"
 	"statefun-sdk-go/pkg/statefun/internal"
 	"statefun-sdk-go/pkg/statefun/internal/protocol"
 	"sync"
@@ -51,7 +52,8 @@ type storageFactory interface {
 func newStorageFactory(
 	batch *protocol.ToFunction_InvocationBatchRequest,
 	specs map[string]*protocol.FromFunction_PersistedValueSpec,
-) storageFactory {
+	valueSpecs map[string]ValueSpec,
+) (storageFactory, error) {
 	storage := &storage{
 		cells: make(map[string]*internal.Cell, len(specs)),
 	}
@@ -68,7 +70,12 @@ func newStorageFactory(
 
 		delete(states, state.StateName)
 
-		storage.cells[state.StateName] = internal.NewCell(state)
+		cell := internal.NewCell(state)
+		if err := reconcileType(valueSpecs[state.StateName], cell); err != nil {
+			return nil, err
+		}
+
+		storage.cells[state.StateName] = cell
 	}
 
 	if len(states) > 0 {
@@ -77,9 +84,59 @@ func newStorageFactory(
 			missing = append(missing, spec)
 		}
 
-		return MissingSpecs(missing)
+		return MissingSpecs(missing), nil
 	} else {
-		return storage
+		return storage, nil
+	}
+}
+
+// Implemented by SimpleTypes that can read persisted
+// values of TypeNames other than their own.
+type typeNameMatcher interface {
+	matchesTypeName(typeName string) bool
+}
+
+// Verifies that the type of a persisted value matches the ValueType
+// it is registered with, applying the spec's TypeMismatch policy if not.
+func reconcileType(spec ValueSpec, cell *internal.Cell) error {
+	if !cell.HasValue() || cell.TypeName() == "" {
+		return nil
+	}
+
+	registered := spec.ValueType.GetTypeName().String()
+	if cell.TypeName() == registered {
+		return nil
+	}
+
+	if matcher, ok := spec.ValueType.(typeNameMatcher); ok && matcher.matchesTypeName(cell.TypeName()) {
+		return nil
+	}
+
+	switch spec.OnTypeMismatch.mode {
+	case resetOnTypeMismatch:
+		cell.Reset()
+		cell.SetTypeName(registered)
+		return nil
+
+	case convertOnTypeMismatch:
+		from, err := ParseTypeName(cell.TypeName())
+		if err != nil {
+			return fmt.Errorf("state %s has an invalid type: %w", spec.Name, err)
+		}
+
+		data, _ := ioutil.ReadAll(cell.Reader())
+		converted, err := spec.OnTypeMismatch.converter(from, data)
+		if err != nil {
+			return fmt.Errorf("failed to convert state %s from %s to %s: %w", spec.Name, from, registered, err)
+		}
+
+		cell.Reset()
+		cell.SetTypeName(registered)
+		_, _ = cell.Write(converted)
+		return nil
+
+	default:
+		return fmt.Errorf("state %s has type %s but is registered as %s", spec.Name, cell.TypeName(), registered)
 	}
 }
 
@@ -91,9 +148,22 @@ func (s *storage) getMissingSpecs() []*protocol.FromFunction_PersistedValueSpec
 	return nil
 }
 
+// Implemented by SimpleTypes whose persisted values
+// may need to be upgraded before they are read.
+type upgradableType interface {
+	// Returns the value, persisted with the given TypeName,
+	// in the current format, or nil if it is already current.
+	upgrade(typeName string, data []byte) ([]byte, error)
+}
+
 func (s *storage) Get(spec ValueSpec, receiver interface{}) bool {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	if upgradable, ok := spec.ValueType.(upgradableType); ok {
+		s.upgrade(spec, upgradable)
+	}
+
+	// reading a cell may encode its cached value
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
 	cell, ok := s.cells[spec.Name]
 	if !ok {
@@ -104,7 +174,7 @@ func (s *storage) Get(spec ValueSpec, receiver interface{}) bool {
 		return false
 	}
 
-	if err := spec.ValueType.Deserialize(cell, receiver); err != nil {
+	if err := spec.ValueType.Deserialize(cell.Reader(), receiver); err != nil {
 		panic(fmt.Errorf("failed to deserialize %s: %w", spec.Name, err))
 	}
 
@@ -120,12 +190,45 @@ func (s *storage) Set(spec ValueSpec, value interface{}) {
 		panic(fmt.Errorf("unregistered ValueSpec %s", spec.Name))
 	}
 
+	cell.Reset()
+	cell.SetTypeName(spec.ValueType.GetTypeName().String())
 	err := spec.ValueType.Serialize(cell, value)
 	if err != nil {
 		panic(fmt.Errorf("failed to serialize %s: %w", spec.Name, err))
 	}
 }
 
+// Upgrades the persisted value of the spec to the current
+// format, writing it back so the runtime stores the upgraded
+// value at the end of the invocation.
+func (s *storage) upgrade(spec ValueSpec, upgradable upgradableType) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cell, ok := s.cells[spec.Name]
+	if !ok {
+		panic(fmt.Errorf("unregistered ValueSpec %s", spec.Name))
+	}
+
+	if !cell.HasValue() {
+		return
+	}
+
+	data, _ := ioutil.ReadAll(cell.Reader())
+	upgraded, err := upgradable.upgrade(cell.TypeName(), data)
+	if err != nil {
+		panic(fmt.Errorf("failed to upgrade %s: %w", spec.Name, err))
+	}
+
+	if upgraded == nil {
+		return
+	}
+
+	cell.Reset()
+	cell.SetTypeName(spec.ValueType.GetTypeName().String())
+	_, _ = cell.Write(upgraded)
+}
+
 func (s *storage) Remove(spec ValueSpec) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -138,6 +241,119 @@ func (s *storage) Remove(spec ValueSpec) {
 	cell.Reset()
 }
 
+// Appends data to the serialized value of the spec without
+// deserializing it, used by ListValueSpec to write only new elements.
+func (s *storage) append(spec ValueSpec, data []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cell, ok := s.cells[spec.Name]
+	if !ok {
+		panic(fmt.Errorf("unregistered ValueSpec %s", spec.Name))
+	}
+
+	cell.SetTypeName(spec.ValueType.GetTypeName().String())
+	_, _ = cell.Write(data)
+}
+
+// Returns the decoded value of the spec, which is cached in its cell
+// so that it is not decoded on every access. Used by MapValueSpec.
+func (s *storage) cached(spec ValueSpec, decode func(data []byte) (interface{}, error)) interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.decode(spec, decode)
+}
+
+// Modifies the cached decoded value of the spec, which is encoded
+// when the value is next read or written back to the runtime.
+func (s *storage) updateCached(
+	spec ValueSpec,
+	decode func(data []byte) (interface{}, error),
+	update func(value interface{}),
+	encode func(value interface{}) []byte,
+) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.decode(spec, decode)
+
+	cell := s.cells[spec.Name]
+	cell.SetTypeName(spec.ValueType.GetTypeName().String())
+	cell.UpdateCached(func(cached interface{}) interface{} {
+		update(cached)
+		return cached
+	}, encode)
+}
+
+func (s *storage) decode(spec ValueSpec, decode func(data []byte) (interface{}, error)) interface{} {
+	cell, ok := s.cells[spec.Name]
+	if !ok {
+		panic(fmt.Errorf("unregistered ValueSpec %s", spec.Name))
+	}
+
+	if cached := cell.Cached(); cached != nil {
+		return cached
+	}
+
+	var data []byte
+	if cell.HasValue() {
+		data, _ = ioutil.ReadAll(cell.Reader())
+	}
+
+	value, err := decode(data)
+	if err != nil {
+		panic(fmt.Errorf("failed to deserialize %s: %w", spec.Name, err))
+	}
+
+	cell.SetCached(value)
+	return value
+}
+
+// Returns a copy of the storage, whose modifications do
+// not affect the original unless it is adopted.
+func (s *storage) fork() *storage {
+	// cloning a cell encodes its cached value
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cells := make(map[string]*internal.Cell, len(s.cells))
+	for name, cell := range s.cells {
+		cells[name] = cell.Clone()
+	}
+
+	return &storage{cells: cells}
+}
+
+// Replaces the values of the storage with those of a fork.
+func (s *storage) adopt(fork *storage) {
+	fork.mutex.RLock()
+	defer fork.mutex.RUnlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cells = fork.cells
+}
+
+func (s *storage) checkpoint() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, cell := range s.cells {
+		cell.Checkpoint()
+	}
+}
+
+func (s *storage) rollback() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, cell := range s.cells {
+		cell.Rollback()
+	}
+}
+
 func (s *storage) getStateMutations() []*protocol.FromFunction_PersistedValueMutation {
 	mutations := make([]*protocol.FromFunction_PersistedValueMutation, 0)
 	for name, cell := range s.cells {
@@ -0,0 +1,100 @@
+package statefun
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"testing"
+)
+
+func storageWithValue(spec ValueSpec, typeName string, value []byte) (*storage, error) {
+	factory, err := newStorageFactory(
+		&protocol.ToFunction_InvocationBatchRequest{
+			State: []*protocol.ToFunction_PersistedValue{{
+				StateName: spec.Name,
+				StateValue: &protocol.TypedValue{
+					Typename: typeName,
+					HasValue: value != nil,
+					Value:    value,
+				},
+			}},
+		},
+		map[string]*protocol.FromFunction_PersistedValueSpec{
+			spec.Name: {StateName: spec.Name, TypeTypename: spec.ValueType.GetTypeName().String()},
+		},
+		map[string]ValueSpec{spec.Name: spec})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return factory.getStorage(), nil
+}
+
+func int32Value(value int32) []byte {
+	buffer := bytes.Buffer{}
+	_ = Int32Type.Serialize(&buffer, value)
+	return buffer.Bytes()
+}
+
+func TestTypeMismatchFails(t *testing.T) {
+	spec := ValueSpec{Name: "seen", ValueType: Int64Type}
+
+	_, err := storageWithValue(spec, "io.statefun.types/int", int32Value(5))
+	assert.Error(t, err, "state written as an int cannot be read as a long")
+
+	storage, err := storageWithValue(spec, "io.statefun.types/int", nil)
+	assert.NoError(t, err, "missing values are not checked")
+	assert.False(t, storage.Get(spec, new(int64)))
+}
+
+func TestTypeMismatchReset(t *testing.T) {
+	spec := ValueSpec{Name: "seen", ValueType: Int64Type, OnTypeMismatch: ResetOnTypeMismatch()}
+
+	storage, err := storageWithValue(spec, "io.statefun.types/int", int32Value(5))
+	assert.NoError(t, err)
+	assert.False(t, storage.Get(spec, new(int64)), "mismatched state should be treated as missing")
+
+	mutations := storage.getStateMutations()
+	assert.Len(t, mutations, 1)
+	assert.Equal(t, protocol.FromFunction_PersistedValueMutation_DELETE, mutations[0].MutationType)
+}
+
+func TestTypeMismatchConvert(t *testing.T) {
+	spec := ValueSpec{
+		Name:      "seen",
+		ValueType: Int64Type,
+		OnTypeMismatch: ConvertOnTypeMismatch(func(from TypeName, data []byte) ([]byte, error) {
+			if from.String() != "io.statefun.types/int" {
+				return nil, errors.New("unexpected type")
+			}
+
+			var value int32
+			if err := Int32Type.Deserialize(bytes.NewReader(data), &value); err != nil {
+				return nil, err
+			}
+
+			buffer := bytes.Buffer{}
+			err := Int64Type.Serialize(&buffer, int64(value))
+			return buffer.Bytes(), err
+		}),
+	}
+
+	storage, err := storageWithValue(spec, "io.statefun.types/int", int32Value(5))
+	assert.NoError(t, err)
+
+	var seen int64
+	assert.True(t, storage.Get(spec, &seen))
+	assert.Equal(t, int64(5), seen)
+
+	mutations := storage.getStateMutations()
+	assert.Len(t, mutations, 1, "converted state should be written back")
+	assert.Equal(t, "io.statefun.types/long", mutations[0].StateValue.Typename)
+
+	_, err = storageWithValue(spec, "org.foo/Unknown", int32Value(5))
+	assert.Error(t, err, "conversion errors should fail the batch")
+
+	err = validateValueSpec(ValueSpec{Name: "seen", ValueType: Int64Type, OnTypeMismatch: ConvertOnTypeMismatch(nil)})
+	assert.Error(t, err)
+}
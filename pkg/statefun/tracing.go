@@ -0,0 +1,209 @@
+package statefun
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"strings"
+)
+
+// A TraceID is the identifier of a trace, shared
+// by every span that belongs to the trace.
+type TraceID [16]byte
+
+// A SpanID is the identifier of a single span within a trace.
+type SpanID [8]byte
+
+// A SpanContext identifies a span and the trace it belongs
+// to. It is the part of a span that is propagated between
+// functions, using the W3C Trace Context format.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Returns true if both the TraceID and SpanID are non-zero.
+func (s SpanContext) IsValid() bool {
+	return s.TraceID != TraceID{} && s.SpanID != SpanID{}
+}
+
+// Returns the SpanContext formatted as a
+// W3C Trace Context traceparent header.
+func (s SpanContext) TraceParent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(s.TraceID[:]), hex.EncodeToString(s.SpanID[:]), flags)
+}
+
+// Parses a W3C Trace Context traceparent header.
+func ParseTraceParent(traceParent string) (SpanContext, error) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", traceParent)
+	}
+
+	var spanContext SpanContext
+	if _, err := hex.Decode(spanContext.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q: %w", traceParent, err)
+	}
+
+	if _, err := hex.Decode(spanContext.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q: %w", traceParent, err)
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q: %w", traceParent, err)
+	}
+
+	spanContext.Sampled = flags[0]&1 == 1
+
+	if !spanContext.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", traceParent)
+	}
+
+	return spanContext, nil
+}
+
+// A Span is a single operation within a trace,
+// created by a Tracer.
+type Span interface {
+	SpanContext() SpanContext
+
+	// Records that the operation failed with the given error.
+	RecordError(err error)
+
+	// Completes the span.
+	End()
+}
+
+// A Tracer creates spans for each function invocation. It is
+// the integration point for tracing libraries such as
+// OpenTelemetry: an implementation should start a span as a
+// child of the given parent and return a context.Context
+// carrying that span, so that it flows into downstream calls
+// made with the function's Context.
+//
+// When a Tracer is registered, the SpanContext of the current
+// invocation travels with messages sent through Context.Send
+// and Context.SendAfter to functions registered with the same
+// builder, or named with StatefulFunctions.WithTracePropagation,
+// and the receiving invocation starts its span as a child of
+// the sender's. Traced messages are wrapped in an envelope
+// other SDKs cannot read, so messages sent to any other
+// function keep their argument unchanged and start a new trace.
+// Egress records are never wrapped; instead, each record sent
+// through Context.SendEgress is captured as a child span of the
+// invocation.
+type Tracer interface {
+	// Starts a new span. The parent is invalid if the message
+	// was not traced, in which case a new trace should be started.
+	Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span)
+}
+
+type spanContextKey struct{}
+
+// Returns the SpanContext of the current invocation, or an invalid
+// SpanContext if the context does not belong to a traced invocation.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if spanContext, ok := ctx.Value(spanContextKey{}).(SpanContext); ok {
+		return spanContext
+	}
+
+	return SpanContext{}
+}
+
+func contextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span.SpanContext())
+}
+
+var tracedMessageTypeName = TypeNameFrom("io.statefun.sdk.go/TracedMessage")
+
+const (
+	tracedMessageTraceParent protowire.Number = 1
+	tracedMessageArgument    protowire.Number = 2
+)
+
+// Wraps the argument of a message in an envelope that carries the span context.
+// The envelope is encoded as the protobuf message:
+//
+//	message TracedMessage {
+//	  string traceparent = 1;
+//	  io.statefun.sdk.reqreply.TypedValue argument = 2;
+//	}
+func wrapTraced(spanContext SpanContext, argument *protocol.TypedValue) (*protocol.TypedValue, error) {
+	inner, err := proto.Marshal(argument)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal traced message: %w", err)
+	}
+
+	var value []byte
+	value = protowire.AppendTag(value, tracedMessageTraceParent, protowire.BytesType)
+	value = protowire.AppendString(value, spanContext.TraceParent())
+	value = protowire.AppendTag(value, tracedMessageArgument, protowire.BytesType)
+	value = protowire.AppendBytes(value, inner)
+
+	return &protocol.TypedValue{
+		Typename: tracedMessageTypeName.String(),
+		HasValue: true,
+		Value:    value,
+	}, nil
+}
+
+// Unwraps a message argument created by wrapTraced. If the argument
+// is not a traced message, it is returned as-is with an invalid span context.
+// If only the traceparent is malformed, the unwrapped argument is returned
+// with an invalid span context along with the error, so that the message
+// can still be delivered.
+func unwrapTraced(argument *protocol.TypedValue) (SpanContext, *protocol.TypedValue, error) {
+	if argument.GetTypename() != tracedMessageTypeName.String() {
+		return SpanContext{}, argument, nil
+	}
+
+	var spanContext SpanContext
+	var traceParentErr error
+	inner := &protocol.TypedValue{}
+
+	value := argument.Value
+	for len(value) > 0 {
+		number, wireType, n := protowire.ConsumeTag(value)
+		if n < 0 {
+			return SpanContext{}, nil, errors.New("malformed traced message")
+		}
+		value = value[n:]
+
+		if wireType != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(number, wireType, value)
+			if n < 0 {
+				return SpanContext{}, nil, errors.New("malformed traced message")
+			}
+			value = value[n:]
+			continue
+		}
+
+		field, n := protowire.ConsumeBytes(value)
+		if n < 0 {
+			return SpanContext{}, nil, errors.New("malformed traced message")
+		}
+		value = value[n:]
+
+		switch number {
+		case tracedMessageTraceParent:
+			spanContext, traceParentErr = ParseTraceParent(string(field))
+		case tracedMessageArgument:
+			if err := proto.Unmarshal(field, inner); err != nil {
+				return SpanContext{}, nil, fmt.Errorf("malformed traced message: %w", err)
+			}
+		}
+	}
+
+	return spanContext, inner, traceParentErr
+}
@@ -0,0 +1,233 @@
+package statefun
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"statefun-sdk-go/pkg/statefun/internal/protocol"
+	"sync"
+	"testing"
+)
+
+func TestTraceParent(t *testing.T) {
+	spanContext := SpanContext{
+		TraceID: TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Sampled: true,
+	}
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", spanContext.TraceParent())
+
+	parsed, err := ParseTraceParent(spanContext.TraceParent())
+	assert.NoError(t, err)
+	assert.Equal(t, spanContext, parsed)
+
+	_, err = ParseTraceParent("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	assert.Error(t, err)
+
+	_, err = ParseTraceParent("garbage")
+	assert.Error(t, err)
+}
+
+func TestTracedMessageEnvelope(t *testing.T) {
+	spanContext := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}}
+	argument := toTypedValue(StringType, "hello")
+
+	traced, err := wrapTraced(spanContext, argument)
+	assert.NoError(t, err)
+	assert.Equal(t, "io.statefun.sdk.go/TracedMessage", traced.Typename)
+
+	parent, unwrapped, err := unwrapTraced(traced)
+	assert.NoError(t, err)
+	assert.Equal(t, spanContext, parent)
+	assert.Equal(t, argument.Typename, unwrapped.Typename)
+	assert.Equal(t, argument.Value, unwrapped.Value)
+
+	parent, unwrapped, err = unwrapTraced(argument)
+	assert.NoError(t, err)
+	assert.False(t, parent.IsValid())
+	assert.Equal(t, argument, unwrapped)
+}
+
+type recordedSpan struct {
+	name        string
+	parent      SpanContext
+	spanContext SpanContext
+	err         error
+	ended       bool
+}
+
+func (r *recordedSpan) SpanContext() SpanContext {
+	return r.spanContext
+}
+
+func (r *recordedSpan) RecordError(err error) {
+	r.err = err
+}
+
+func (r *recordedSpan) End() {
+	r.ended = true
+}
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	span := &recordedSpan{
+		name:   name,
+		parent: parent,
+		spanContext: SpanContext{
+			TraceID: parent.TraceID,
+			SpanID:  SpanID{byte(len(r.spans) + 1)},
+		},
+	}
+
+	if !parent.IsValid() {
+		span.spanContext.TraceID = TraceID{0xab}
+	}
+
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+func TestTracePropagation(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	builder := StatefulFunctionsBuilder()
+	builder.WithTracer(tracer)
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, msg Message) error {
+			assert.True(t, msg.IsString(), "traced messages should be unwrapped")
+			assert.True(t, SpanContextFromContext(ctx).IsValid())
+
+			ctx.Send(MessageBuilder{
+				Target: Address{FunctionType: TypeNameFrom("org.foo/greeter"), Id: "1"},
+				Value:  msg.AsString(),
+			})
+
+			ctx.SendEgress(GenericEgressBuilder{
+				Target:    TypeNameFrom("e/out"),
+				Value:     msg.AsString(),
+				ValueType: StringType,
+			})
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	response, from := invokeBatch(t, builder, "hello")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	result := from.GetInvocationResult()
+	outgoing := result.OutgoingMessages[0].Argument
+	assert.Equal(t, tracedMessageTypeName.String(), outgoing.Typename)
+	assert.Equal(t, StringType.GetTypeName().String(), result.OutgoingEgresses[0].Argument.Typename)
+
+	assert.Len(t, tracer.spans, 2)
+	root, egress := tracer.spans[0], tracer.spans[1]
+	assert.Equal(t, "invoke org.foo/greeter", root.name)
+	assert.False(t, root.parent.IsValid())
+	assert.True(t, root.ended)
+	assert.Equal(t, "egress e/out", egress.name)
+	assert.Equal(t, root.spanContext, egress.parent)
+
+	// deliver the traced message to the next function
+	toFunction := &protocol.ToFunction{
+		Request: &protocol.ToFunction_Invocation_{
+			Invocation: &protocol.ToFunction_InvocationBatchRequest{
+				Target: result.OutgoingMessages[0].Target,
+				State: []*protocol.ToFunction_PersistedValue{
+					{StateName: "seen", StateValue: &protocol.TypedValue{Typename: "io.statefun.types/int"}},
+				},
+				Invocations: []*protocol.ToFunction_Invocation{{Argument: outgoing}},
+			},
+		},
+	}
+
+	_, err = builder.(*handler).invoke(context.Background(), toFunction)
+	assert.NoError(t, err)
+
+	child := tracer.spans[2]
+	assert.Equal(t, root.spanContext, child.parent)
+	assert.Equal(t, root.spanContext.TraceID, child.spanContext.TraceID)
+}
+
+func TestTracePropagationIsOptIn(t *testing.T) {
+	builder := StatefulFunctionsBuilder()
+	builder.WithTracer(&recordingTracer{})
+	builder.WithTracePropagation(TypeNameFrom("org.go/remote"))
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, msg Message) error {
+			for _, target := range []string{"org.go/remote", "org.python/remote"} {
+				ctx.Send(MessageBuilder{
+					Target: Address{FunctionType: TypeNameFrom(target), Id: "1"},
+					Value:  msg.AsString(),
+				})
+			}
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	response, from := invokeBatch(t, builder, "hello")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	outgoing := from.GetInvocationResult().OutgoingMessages
+	assert.Equal(t, tracedMessageTypeName.String(), outgoing[0].Argument.Typename)
+	assert.Equal(t, StringType.GetTypeName().String(), outgoing[1].Argument.Typename, "messages to other SDKs should not be wrapped")
+}
+
+func TestMalformedTraceParentStartsNewTrace(t *testing.T) {
+	argument := toTypedValue(StringType, "hello")
+	traced, err := wrapTraced(SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}}, argument)
+	assert.NoError(t, err)
+
+	// replace the traceparent with one of the same length whose trace id is not hex
+	malformed := bytes.Replace(traced.Value, []byte("01000000"), []byte("zz000000"), 1)
+	traced.Value = malformed
+
+	parent, unwrapped, err := unwrapTraced(traced)
+	assert.Error(t, err)
+	assert.False(t, parent.IsValid())
+	assert.Equal(t, argument.Value, unwrapped.Value, "the argument should still be delivered")
+
+	tracer := &recordingTracer{}
+	builder := StatefulFunctionsBuilder()
+	builder.WithTracer(tracer)
+	err = builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{Seen},
+		Function: StatefulFunctionPointer(func(ctx Context, msg Message) error {
+			assert.Equal(t, "hello", msg.AsString())
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	toFunction := &protocol.ToFunction{
+		Request: &protocol.ToFunction_Invocation_{
+			Invocation: &protocol.ToFunction_InvocationBatchRequest{
+				Target: &protocol.Address{Namespace: "org.foo", Type: "greeter", Id: "1"},
+				State: []*protocol.ToFunction_PersistedValue{
+					{StateName: "seen", StateValue: &protocol.TypedValue{Typename: "io.statefun.types/int"}},
+				},
+				Invocations: []*protocol.ToFunction_Invocation{{Argument: traced}},
+			},
+		},
+	}
+
+	_, err = builder.(*handler).invoke(context.Background(), toFunction)
+	assert.NoError(t, err)
+	assert.Len(t, tracer.spans, 1)
+	assert.False(t, tracer.spans[0].parent.IsValid(), "a malformed traceparent should start a new trace")
+}
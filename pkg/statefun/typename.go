@@ -8,12 +8,17 @@ import (
 )
 
 var (
-	boolTypeName    = TypeNameFrom("io.statefun.types/bool")
-	int32TypeName   = TypeNameFrom("io.statefun.types/int")
-	int64TypeName   = TypeNameFrom("io.statefun.types/long")
-	float32TypeName = TypeNameFrom("io.statefun.types/float")
-	float64ypeName  = TypeNameFrom("io.statefun.types/double")
-	stringTypeName  = TypeNameFrom("io.statefun.types/string")
+	boolTypeName     = TypeNameFrom("io.statefun.types/bool")
+	int32TypeName    = TypeNameFrom("io.statefun.types/int")
+	int64TypeName    = TypeNameFrom("io.statefun.types/long")
+	float32TypeName  = TypeNameFrom("io.statefun.types/float")
+	float64ypeName   = TypeNameFrom("io.statefun.types/double")
+	stringTypeName   = TypeNameFrom("io.statefun.types/string")
+	bytesTypeName    = TypeNameFrom("io.statefun.types/bytes")
+	uint32TypeName   = TypeNameFrom("io.statefun.types/uint")
+	uint64TypeName   = TypeNameFrom("io.statefun.types/ulong")
+	timeTypeName     = TypeNameFrom("io.statefun.types/timestamp")
+	durationTypeName = TypeNameFrom("io.statefun.types/duration")
 )
 
 // A TypeName is used to uniquely identify objects within
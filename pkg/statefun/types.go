@@ -1,14 +1,18 @@
 package statefun
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
 	"google.golang.org/protobuf/proto"
 	"io"
 	"io/ioutil"
-	"log"
 	"strings"
+	"time"
 )
 
 // This interface is the core abstraction used byt Stateful
@@ -26,17 +30,27 @@ import (
 // with predefined TypeName's.
 //
 // These primitives have standard encoding across all StateFun language
-// SDKs, so functions in various other languages (Java, Python, etc) can
-// message Golang functions by directly sending supported primitive
-// values as message arguments. Moreover, the type system is used for
-// state values as well; so you can expect that a function can safely
-// read previous state after reimplementing it in a different language.
+// SDKs, where each value is wrapped in a small protobuf message such as
+// io.statefun.sdk.types.IntWrapper, so functions in various other
+// languages (Java, Python, etc) can message Golang functions by
+// directly sending supported primitive values as message arguments.
+// Moreover, the type system is used for state values as well; so you
+// can expect that a function can safely read previous state after
+// reimplementing it in a different language.
+//
+// The Go SDK additionally ships built-in types for raw bytes, unsigned
+// integers, time.Time and time.Duration. These are not part of the
+// Java and Python SDKs' built-in types, but use TypeName's in the
+// same io.statefun.types namespace and are encoded as the matching
+// google.protobuf well-known types, so those SDKs can read them by
+// registering a custom type with the same name.
 //
 // Common custom types
 //
 // The type system is also very easily extensible to support more complex types.
-// The Go SDK ships with predefined support for JSON and Protobuf - see MakeJsonType
-// MakeProtobufType. For other formats, it is just a matter of implementing
+// The Go SDK ships with predefined support for JSON, Protobuf, Avro, MessagePack
+// and CBOR - see MakeJsonType, MakeProtobufType, MakeAvroType, MakeMsgpackType
+// and MakeCborType. For other formats, it is just a matter of implementing
 // your own SimpleType with a custom typename and serializer.
 type SimpleType interface {
 	GetTypeName() TypeName
@@ -55,6 +69,21 @@ const (
 	Float32Type
 	Float64Type
 	StringType
+
+	// Raw bytes, encoded as google.protobuf.BytesValue.
+	BytesType
+
+	// Unsigned integers, encoded as google.protobuf.UInt32Value
+	// and google.protobuf.UInt64Value.
+	Uint32Type
+	Uint64Type
+
+	// A time.Time, encoded as google.protobuf.Timestamp. The
+	// location is not preserved, values are always read as UTC.
+	TimeType
+
+	// A time.Duration, encoded as google.protobuf.Duration.
+	DurationType
 )
 
 func (p PrimitiveType) GetTypeName() TypeName {
@@ -71,15 +100,72 @@ func (p PrimitiveType) GetTypeName() TypeName {
 		return float64ypeName
 	case StringType:
 		return stringTypeName
+	case BytesType:
+		return bytesTypeName
+	case Uint32Type:
+		return uint32TypeName
+	case Uint64Type:
+		return uint64TypeName
+	case TimeType:
+		return timeTypeName
+	case DurationType:
+		return durationTypeName
 	default:
-		log.Fatalf("unknown primitive type %v", p)
-		// unreachable
-		return nil
+		panic(fmt.Errorf("unknown primitive type %d", int(p)))
 	}
 }
 
+// Reads a value encoded as the protobuf wrapper message of the
+// primitive. For BoolType, Int32Type, Int64Type, Float32Type and
+// Float64Type, values written with the raw encoding of earlier
+// versions of the Go SDK are read as well, since their length
+// never matches that of a wrapper message.
 func (p PrimitiveType) Deserialize(r io.Reader, receiver interface{}) error {
-	switch p {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if width := p.rawWidth(); width > 0 && len(data) == width {
+		return rawPrimitiveType{p}.Deserialize(bytes.NewReader(data), receiver)
+	}
+
+	return p.unwrap(data, receiver)
+}
+
+func (p PrimitiveType) Serialize(writer io.Writer, data interface{}) error {
+	wrapper, err := p.wrap(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(wrapper)
+	return err
+}
+
+// Returns a SimpleType with the same TypeName that reads and writes
+// values using the raw encoding of earlier versions of the Go SDK,
+// where numbers are written big-endian and strings and bytes are
+// written as is. It is not understood by the other StateFun SDKs.
+//
+// The raw encoding of strings, bytes, unsigned integers, times and
+// durations cannot be told apart from a wrapper message, so state
+// of those types written by an earlier version must be read with
+// this type. To migrate such state, declare a ValueSpec with the
+// raw type under the old name, and move each value to a ValueSpec
+// with the PrimitiveType under a new name as it is read. The other
+// primitive types need no migration: their raw values are read by
+// PrimitiveType and written back as wrapper messages.
+func (p PrimitiveType) WithRawEncoding() SimpleType {
+	return rawPrimitiveType{p}
+}
+
+type rawPrimitiveType struct {
+	PrimitiveType
+}
+
+func (p rawPrimitiveType) Deserialize(r io.Reader, receiver interface{}) error {
+	switch p.PrimitiveType {
 	case BoolType:
 		switch receiver.(type) {
 		case *bool:
@@ -125,15 +211,63 @@ func (p PrimitiveType) Deserialize(r io.Reader, receiver interface{}) error {
 		default:
 			return errors.New("receiver must be of type *string")
 		}
+	case BytesType:
+		switch receiver := receiver.(type) {
+		case *[]byte:
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			*receiver = data
+			return nil
+		default:
+			return errors.New("receiver must be of type *[]byte")
+		}
+	case Uint32Type:
+		switch receiver.(type) {
+		case *uint32:
+			return binary.Read(r, binary.BigEndian, receiver)
+		default:
+			return errors.New("receiver must be of type *uint32")
+		}
+	case Uint64Type:
+		switch receiver.(type) {
+		case *uint64:
+			return binary.Read(r, binary.BigEndian, receiver)
+		default:
+			return errors.New("receiver must be of type *uint64")
+		}
+	case TimeType:
+		switch receiver := receiver.(type) {
+		case *time.Time:
+			seconds, nanos, err := readSecondsAndNanos(r)
+			if err != nil {
+				return err
+			}
+			*receiver = time.Unix(seconds, int64(nanos)).UTC()
+			return nil
+		default:
+			return errors.New("receiver must be of type *time.Time")
+		}
+	case DurationType:
+		switch receiver := receiver.(type) {
+		case *time.Duration:
+			seconds, nanos, err := readSecondsAndNanos(r)
+			if err != nil {
+				return err
+			}
+			*receiver = time.Duration(seconds)*time.Second + time.Duration(nanos)
+			return nil
+		default:
+			return errors.New("receiver must be of type *time.Duration")
+		}
 	default:
-		log.Fatalf("unknown primitive type %v", p)
-		// unreachable
-		return nil
+		panic(fmt.Errorf("unknown primitive type %d", int(p.PrimitiveType)))
 	}
 }
 
-func (p PrimitiveType) Serialize(writer io.Writer, data interface{}) error {
-	switch p {
+func (p rawPrimitiveType) Serialize(writer io.Writer, data interface{}) error {
+	switch p.PrimitiveType {
 	case BoolType:
 		switch data.(type) {
 		case bool, *bool:
@@ -192,13 +326,71 @@ func (p PrimitiveType) Serialize(writer io.Writer, data interface{}) error {
 		default:
 			return errors.New("data must be of type string or *string")
 		}
+	case BytesType:
+		switch data := data.(type) {
+		case []byte:
+			_, err := writer.Write(data)
+			return err
+		case *[]byte:
+			_, err := writer.Write(*data)
+			return err
+		default:
+			return errors.New("data must be of type []byte or *[]byte")
+		}
+	case Uint32Type:
+		switch data.(type) {
+		case uint32, *uint32:
+			return binary.Write(writer, binary.BigEndian, data)
+		default:
+			return errors.New("data must be of type uint32 or *uint32")
+		}
+	case Uint64Type:
+		switch data.(type) {
+		case uint64, *uint64:
+			return binary.Write(writer, binary.BigEndian, data)
+		default:
+			return errors.New("data must be of type uint64 or *uint64")
+		}
+	case TimeType:
+		switch data := data.(type) {
+		case time.Time:
+			return writeSecondsAndNanos(writer, data.Unix(), int32(data.Nanosecond()))
+		case *time.Time:
+			return writeSecondsAndNanos(writer, data.Unix(), int32(data.Nanosecond()))
+		default:
+			return errors.New("data must be of type time.Time or *time.Time")
+		}
+	case DurationType:
+		switch data := data.(type) {
+		case time.Duration:
+			return writeSecondsAndNanos(writer, int64(data/time.Second), int32(data%time.Second))
+		case *time.Duration:
+			return writeSecondsAndNanos(writer, int64(*data/time.Second), int32(*data%time.Second))
+		default:
+			return errors.New("data must be of type time.Duration or *time.Duration")
+		}
 	default:
-		log.Fatalf("unknown primitive type %v", p)
-		// unreachable
-		return nil
+		panic(fmt.Errorf("unknown primitive type %d", int(p.PrimitiveType)))
 	}
 }
 
+func writeSecondsAndNanos(writer io.Writer, seconds int64, nanos int32) error {
+	buffer := make([]byte, 12)
+	binary.BigEndian.PutUint64(buffer, uint64(seconds))
+	binary.BigEndian.PutUint32(buffer[8:], uint32(nanos))
+	_, err := writer.Write(buffer)
+	return err
+}
+
+func readSecondsAndNanos(r io.Reader) (int64, int32, error) {
+	buffer := make([]byte, 12)
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(binary.BigEndian.Uint64(buffer)), int32(binary.BigEndian.Uint32(buffer[8:])), nil
+}
+
 type jsonType struct {
 	typeName TypeName
 }
@@ -221,6 +413,65 @@ func (j jsonType) Serialize(writer io.Writer, data interface{}) error {
 	return json.NewEncoder(writer).Encode(data)
 }
 
+type msgpackType struct {
+	typeName TypeName
+}
+
+// Creates a new SimpleType with a given TypeName using
+// MessagePack. Structs are encoded following the same
+// struct tag conventions as the standard Go JSON library,
+// and map keys are sorted so encodings are deterministic.
+func MakeMsgpackType(name TypeName) SimpleType {
+	return msgpackType{typeName: name}
+}
+
+func (m msgpackType) GetTypeName() TypeName {
+	return m.typeName
+}
+
+func (m msgpackType) Deserialize(r io.Reader, receiver interface{}) error {
+	decoder := msgpack.NewDecoder(r)
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(receiver)
+}
+
+func (m msgpackType) Serialize(writer io.Writer, data interface{}) error {
+	encoder := msgpack.NewEncoder(writer)
+	encoder.SetCustomStructTag("json")
+	encoder.SetSortMapKeys(true)
+	return encoder.Encode(data)
+}
+
+// CBOR encodes using the core deterministic encoding
+// requirements of RFC 8949, so equal values are always
+// encoded to the same bytes. Map keys are sorted by their
+// encoded bytes, so shorter keys come first; this is not
+// the lexical order of the standard Go JSON library.
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+type cborType struct {
+	typeName TypeName
+}
+
+// Creates a new SimpleType with a given TypeName using
+// CBOR. Structs are encoded following the same struct
+// tag conventions as the standard Go JSON library.
+func MakeCborType(name TypeName) SimpleType {
+	return cborType{typeName: name}
+}
+
+func (c cborType) GetTypeName() TypeName {
+	return c.typeName
+}
+
+func (c cborType) Deserialize(r io.Reader, receiver interface{}) error {
+	return cbor.NewDecoder(r).Decode(receiver)
+}
+
+func (c cborType) Serialize(writer io.Writer, data interface{}) error {
+	return cborEncMode.NewEncoder(writer).Encode(data)
+}
+
 type protoType struct {
 	typeName TypeName
 }
@@ -3,7 +3,9 @@ package statefun
 import (
 	"bytes"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestBoolType(t *testing.T) {
@@ -78,6 +80,69 @@ func TestStringType(t *testing.T) {
 	assert.Equal(t, result, "hello world")
 }
 
+func TestBytesType(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := BytesType.Serialize(&buffer, []byte{0x00, 0x01, 0xFF})
+	assert.NoError(t, err)
+
+	var result []byte
+	err = BytesType.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+
+	assert.Equal(t, result, []byte{0x00, 0x01, 0xFF})
+}
+
+func TestUnsignedTypes(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := Uint32Type.Serialize(&buffer, uint32(1<<31))
+	assert.NoError(t, err)
+	assert.Equal(t, buffer.Bytes(), []byte{0x08, 0x80, 0x80, 0x80, 0x80, 0x08})
+
+	var result32 uint32
+	err = Uint32Type.Deserialize(bytes.NewReader(buffer.Bytes()), &result32)
+	assert.NoError(t, err)
+	assert.Equal(t, result32, uint32(1<<31))
+
+	buffer.Reset()
+	err = Uint64Type.Serialize(&buffer, uint64(1<<63))
+	assert.NoError(t, err)
+
+	var result64 uint64
+	err = Uint64Type.Deserialize(bytes.NewReader(buffer.Bytes()), &result64)
+	assert.NoError(t, err)
+	assert.Equal(t, result64, uint64(1<<63))
+}
+
+func TestTimeType(t *testing.T) {
+	location := time.FixedZone("UTC+2", 2*60*60)
+	value := time.Date(1969, time.July, 20, 22, 56, 15, 123456789, location)
+
+	buffer := bytes.Buffer{}
+	err := TimeType.Serialize(&buffer, value)
+	assert.NoError(t, err)
+
+	var result time.Time
+	err = TimeType.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+
+	assert.True(t, result.Equal(value))
+	assert.Equal(t, result.Location(), time.UTC)
+}
+
+func TestDurationType(t *testing.T) {
+	for _, value := range []time.Duration{0, 90 * time.Minute, -1500 * time.Millisecond, time.Nanosecond} {
+		buffer := bytes.Buffer{}
+		err := DurationType.Serialize(&buffer, value)
+		assert.NoError(t, err)
+
+		var result time.Duration
+		err = DurationType.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, result, value)
+	}
+}
+
 type User struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
@@ -96,3 +161,113 @@ func TestJsonType(t *testing.T) {
 
 	assert.Equal(t, result, User{"bob", "mop"})
 }
+
+func TestMsgpackType(t *testing.T) {
+	buffer := bytes.Buffer{}
+	userType := MakeMsgpackType(TypeNameFrom("org.foo.bar/UserMsgpack"))
+
+	err := userType.Serialize(&buffer, User{"bob", "mop"})
+	assert.NoError(t, err)
+
+	var fields map[string]string
+	err = userType.Deserialize(bytes.NewReader(buffer.Bytes()), &fields)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"first_name": "bob", "last_name": "mop"}, fields, "struct fields should use json tags")
+
+	var result User
+	err = userType.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+
+	assert.Equal(t, result, User{"bob", "mop"})
+}
+
+func TestCborType(t *testing.T) {
+	buffer := bytes.Buffer{}
+	userType := MakeCborType(TypeNameFrom("org.foo.bar/UserCbor"))
+
+	err := userType.Serialize(&buffer, User{"bob", "mop"})
+	assert.NoError(t, err)
+
+	var fields map[string]string
+	err = userType.Deserialize(bytes.NewReader(buffer.Bytes()), &fields)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"first_name": "bob", "last_name": "mop"}, fields, "struct fields should use json tags")
+
+	var result User
+	err = userType.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+
+	assert.Equal(t, result, User{"bob", "mop"})
+}
+
+type benchmarkRecord struct {
+	Id       string            `json:"id"`
+	Visits   int64             `json:"visits"`
+	Score    float64           `json:"score"`
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+var benchmarkValue = benchmarkRecord{
+	Id:     "a8b7c6d5-e4f3-4a2b-9c1d-0e9f8a7b6c5d",
+	Visits: 1024,
+	Score:  98.6,
+	Tags:   []string{"premium", "eu-west", "beta"},
+	Metadata: map[string]string{
+		"source":  "kafka",
+		"version": "3",
+	},
+}
+
+// Compares the serialization cost and encoded size of the
+// structured SimpleTypes. Run with:
+//
+//	go test -run=^$ -bench=Type ./pkg/statefun
+func benchmarkType(b *testing.B, simpleType SimpleType) {
+	buffer := bytes.Buffer{}
+	if err := simpleType.Serialize(&buffer, benchmarkValue); err != nil {
+		b.Fatal(err)
+	}
+	size := float64(buffer.Len())
+
+	b.Run("Serialize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buffer.Reset()
+			_ = simpleType.Serialize(&buffer, benchmarkValue)
+		}
+		b.ReportMetric(size, "bytes/value")
+	})
+
+	encoded := append([]byte(nil), buffer.Bytes()...)
+	b.Run("Deserialize", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var result benchmarkRecord
+			_ = simpleType.Deserialize(bytes.NewReader(encoded), &result)
+		}
+		b.ReportMetric(size, "bytes/value")
+	})
+}
+
+func BenchmarkJsonType(b *testing.B) {
+	benchmarkType(b, MakeJsonType(TypeNameFrom("org.foo/Record")))
+}
+
+func BenchmarkMsgpackType(b *testing.B) {
+	benchmarkType(b, MakeMsgpackType(TypeNameFrom("org.foo/Record")))
+}
+
+func BenchmarkCborType(b *testing.B) {
+	benchmarkType(b, MakeCborType(TypeNameFrom("org.foo/Record")))
+}
+
+func TestCborTypeKeyOrder(t *testing.T) {
+	buffer := bytes.Buffer{}
+	err := MakeCborType(TypeNameFrom("org.foo.bar/Map")).Serialize(&buffer, map[string]int{"bb": 1, "c": 2, "a": 3})
+	assert.NoError(t, err)
+
+	encoded := buffer.String()
+	a, c, bb := strings.Index(encoded, "a"), strings.Index(encoded, "c"), strings.Index(encoded, "bb")
+	assert.True(t, a < c && c < bb, "shorter keys should be encoded first")
+}
@@ -0,0 +1,73 @@
+package statefun
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A Value is a type-safe accessor for a persisted value of type T.
+// It embeds the ValueSpec it reads and writes, so it can be
+// registered directly on a StatefulFunctionSpec.
+//
+//	var Seen = statefun.Value[int32]{ValueSpec: statefun.ValueSpec{
+//		Name:      "seen",
+//		ValueType: statefun.Int32Type,
+//	}}
+//
+//	statefun.StatefulFunctionSpec{
+//		States: []statefun.ValueSpec{Seen.ValueSpec},
+//		...
+//	}
+//
+//	seen, _ := Seen.Get(ctx)
+//	Seen.Set(ctx, seen+1)
+type Value[T any] struct {
+	ValueSpec
+}
+
+// Creates a new Value, verifying that the spec's
+// SimpleType is able to serialize values of type T.
+func MakeValue[T any](spec ValueSpec) (Value[T], error) {
+	if spec.ValueType == nil {
+		return Value[T]{}, fmt.Errorf("ValueSpec %s is missing a ValueType", spec.Name)
+	}
+
+	var zero T
+	if err := spec.ValueType.Serialize(&bytes.Buffer{}, zero); err != nil {
+		return Value[T]{}, fmt.Errorf("ValueSpec %s of type %s cannot store %T: %w", spec.Name, spec.ValueType.GetTypeName(), zero, err)
+	}
+
+	return Value[T]{ValueSpec: spec}, nil
+}
+
+// Gets the value scoped to the current invoked Address. The method
+// returns false if there is no value in storage, so callers can
+// differentiate between missing and the type's zero value.
+func (v Value[T]) Get(ctx Context) (T, bool) {
+	var value T
+	exists := ctx.Storage().Get(v.ValueSpec, &value)
+	return value, exists
+}
+
+// Sets the value scoped to the current invoked Address.
+func (v Value[T]) Set(ctx Context, value T) {
+	ctx.Storage().Set(v.ValueSpec, value)
+}
+
+// Removes the value scoped to the current invoked Address.
+func (v Value[T]) Remove(ctx Context) {
+	ctx.Storage().Remove(v.ValueSpec)
+}
+
+// Deserializes the message's value as a T using the given SimpleType.
+//
+//	request, err := statefun.As[GreetRequest](msg, GreetRequestType)
+func As[T any](message Message, t SimpleType) (T, error) {
+	var value T
+	if !message.Is(t) {
+		return value, fmt.Errorf("message is of type %s, not %s", message.ValueTypeName(), t.GetTypeName())
+	}
+
+	err := message.As(t, &value)
+	return value, err
+}
@@ -2,7 +2,6 @@ package statefun
 
 import (
 	"fmt"
-	"log"
 	"regexp"
 	"time"
 )
@@ -64,6 +63,49 @@ func ExpireAfterWrite(duration time.Duration) Expiration {
 	}
 }
 
+type typeMismatchMode int
+
+const (
+	failOnTypeMismatch typeMismatchMode = iota
+	resetOnTypeMismatch
+	convertOnTypeMismatch
+)
+
+// A TypeConverter converts a persisted value of the given
+// type into the format of the ValueType it is registered with.
+type TypeConverter func(from TypeName, data []byte) ([]byte, error)
+
+// Type Mismatch Configuration
+//
+// Defines how a persisted value is handled when the type reported
+// by the runtime does not match the ValueType of its ValueSpec, for
+// example after changing a state from Int32Type to Int64Type. By
+// default, the mismatch fails the invocation batch.
+type TypeMismatch struct {
+	mode      typeMismatchMode
+	converter TypeConverter
+}
+
+// Returns a TypeMismatch configuration that fails the invocation
+// batch, so that it is retried by the runtime. This is the default.
+func FailOnTypeMismatch() TypeMismatch {
+	return TypeMismatch{mode: failOnTypeMismatch}
+}
+
+// Returns a TypeMismatch configuration that treats the value as
+// missing. The value is removed, and subsequent writes are stored
+// under the registered ValueType.
+func ResetOnTypeMismatch() TypeMismatch {
+	return TypeMismatch{mode: resetOnTypeMismatch}
+}
+
+// Returns a TypeMismatch configuration that converts the value
+// using the given TypeConverter. The converted value is written
+// back under the registered ValueType.
+func ConvertOnTypeMismatch(converter TypeConverter) TypeMismatch {
+	return TypeMismatch{mode: convertOnTypeMismatch, converter: converter}
+}
+
 // A ValueSpec identifies a registered persistent value of a function, which will be
 // managed by the Stateful Functions runtime for consistency and fault-tolerance. A
 // ValueSpec is registered for a function by configuring it on the function's
@@ -84,6 +126,10 @@ type ValueSpec struct {
 
 	// An optional expiration configuration.
 	Expiration Expiration
+
+	// An optional configuration for values whose type, as
+	// reported by the runtime, does not match ValueType.
+	OnTypeMismatch TypeMismatch
 }
 
 const invalidNameMessage = `
@@ -93,12 +139,16 @@ invalid state tpe %s. state names can only start with alphabet letters [a-z][A-Z
 func validateValueSpec(s ValueSpec) error {
 	matched, err := regexp.MatchString("^[a-zA-Z_][a-zA-Z_\\d]*$", s.Name)
 	if err != nil {
-		log.Panicf("invalid regex; this is a bug: %v", err)
+		panic(fmt.Errorf("invalid regex; this is a bug: %w", err))
 	}
 
 	if !matched {
 		return fmt.Errorf(invalidNameMessage, s.Name)
 	}
 
+	if s.OnTypeMismatch.mode == convertOnTypeMismatch && s.OnTypeMismatch.converter == nil {
+		return fmt.Errorf("state %s requires a TypeConverter", s.Name)
+	}
+
 	return nil
 }
@@ -0,0 +1,69 @@
+package statefun
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	seen := Value[int32]{ValueSpec: Seen}
+
+	var observed []int32
+	builder := StatefulFunctionsBuilder()
+	err := builder.WithSpec(StatefulFunctionSpec{
+		FunctionType: TypeNameFrom("org.foo/greeter"),
+		States:       []ValueSpec{seen.ValueSpec},
+		Function: StatefulFunctionPointer(func(ctx Context, message Message) error {
+			count, exists := seen.Get(ctx)
+			if message.AsString() == "reset" {
+				assert.True(t, exists)
+				seen.Remove(ctx)
+				return nil
+			}
+
+			observed = append(observed, count)
+			seen.Set(ctx, count+1)
+			return nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	response, from := invokeBatch(t, builder, "a", "b", "reset", "c")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []int32{0, 1, 0}, observed)
+
+	var count int32
+	mutation := from.GetInvocationResult().StateMutations[0]
+	assert.NoError(t, Int32Type.Deserialize(bytes.NewReader(mutation.StateValue.Value), &count))
+	assert.Equal(t, int32(1), count)
+}
+
+func TestMakeValue(t *testing.T) {
+	_, err := MakeValue[int32](Seen)
+	assert.NoError(t, err)
+
+	_, err = MakeValue[int64](Seen)
+	assert.Error(t, err, "an int32 ValueSpec cannot store int64 values")
+
+	_, err = MakeValue[User](ValueSpec{Name: "user", ValueType: MakeJsonType(TypeNameFrom("org.foo/User"))})
+	assert.NoError(t, err)
+}
+
+func TestAs(t *testing.T) {
+	userType := MakeJsonType(TypeNameFrom("org.foo/User"))
+	message, err := MessageBuilder{
+		Target:    Address{FunctionType: TypeNameFrom("org.foo/greeter"), Id: "0"},
+		Value:     User{FirstName: "bob", LastName: "mop"},
+		ValueType: userType,
+	}.ToMessage()
+	assert.NoError(t, err)
+
+	user, err := As[User](message, userType)
+	assert.NoError(t, err)
+	assert.Equal(t, User{FirstName: "bob", LastName: "mop"}, user)
+
+	_, err = As[string](message, StringType)
+	assert.Error(t, err, "a message cannot be read as a different type")
+}
@@ -0,0 +1,219 @@
+package statefun
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A Migration upgrades a serialized value by one version,
+// returning the value in the format of the next version.
+// The data is the payload of the wrapped SimpleType,
+// without the version header.
+type Migration func(data []byte) ([]byte, error)
+
+// The marker that prefixes every value written by a VersionedType.
+var versionMarker = [2]byte{0xFE, 0x56}
+
+const versionSeparator = "@v"
+
+// A VersionedType wraps a SimpleType to support evolving the shape
+// of persisted values. Each value is written with a header holding
+// the current version, and values written with an older version are
+// upgraded through the registered migrations when they are read.
+//
+//	var UserType = statefun.MakeVersionedType(statefun.MakeJsonType(UserTypeName), 2).
+//		WithMigration(0, addLastName).
+//		WithMigration(1, renameFields)
+//
+// The version is also part of the type's TypeName, for example
+// org.foo/User@v2, so that the type of persisted state reported
+// by the runtime identifies the version it was written with.
+// When used as the ValueType of a ValueSpec, state written with an
+// older version is upgraded on read and written back in the
+// current format.
+//
+// Values written by the wrapped SimpleType before it was versioned,
+// which have no header, are read as version 0.
+type VersionedType struct {
+	inner      SimpleType
+	version    int
+	typeName   TypeName
+	migrations map[int]Migration
+}
+
+// Creates a new VersionedType that writes values at the given version.
+func MakeVersionedType(inner SimpleType, version int) *VersionedType {
+	if version < 0 {
+		panic(fmt.Errorf("invalid version %d", version))
+	}
+
+	typeName, _ := TypeNameFromParts(
+		inner.GetTypeName().GetNamespace(),
+		inner.GetTypeName().GetType()+versionSeparator+strconv.Itoa(version))
+
+	return &VersionedType{
+		inner:      inner,
+		version:    version,
+		typeName:   typeName,
+		migrations: map[int]Migration{},
+	}
+}
+
+// Registers the migration that upgrades values
+// from the given version to the next one.
+func (v *VersionedType) WithMigration(from int, migration Migration) *VersionedType {
+	if from < 0 || from >= v.version {
+		panic(fmt.Errorf("cannot register migration from version %d for %s", from, v.typeName))
+	}
+
+	v.migrations[from] = migration
+	return v
+}
+
+// Returns the version values are written with.
+func (v *VersionedType) Version() int {
+	return v.version
+}
+
+func (v *VersionedType) GetTypeName() TypeName {
+	return v.typeName
+}
+
+func (v *VersionedType) Deserialize(r io.Reader, receiver interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	version, payload, err := readVersion(data)
+	if err != nil {
+		return err
+	}
+
+	if payload, err = v.migrate(version, payload); err != nil {
+		return err
+	}
+
+	return v.inner.Deserialize(bytes.NewReader(payload), receiver)
+}
+
+func (v *VersionedType) Serialize(writer io.Writer, data interface{}) error {
+	if _, err := writer.Write(versionHeader(v.version)); err != nil {
+		return err
+	}
+
+	return v.inner.Serialize(writer, data)
+}
+
+// Upgrades a persisted value, whose type the runtime reported as
+// typeName, to the current version. It returns nil if the value is
+// already current.
+func (v *VersionedType) upgrade(typeName string, data []byte) ([]byte, error) {
+	version, payload, err := readVersion(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.checkTypeName(typeName, version); err != nil {
+		return nil, err
+	}
+
+	if version == v.version {
+		return nil, nil
+	}
+
+	if payload, err = v.migrate(version, payload); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.Write(versionHeader(v.version))
+	buffer.Write(payload)
+	return buffer.Bytes(), nil
+}
+
+// Returns true if the TypeName is this type at any version,
+// or the wrapped type from before it was versioned.
+func (v *VersionedType) matchesTypeName(typeName string) bool {
+	base := v.inner.GetTypeName().String()
+	if typeName == base {
+		return true
+	}
+
+	_, err := strconv.Atoi(strings.TrimPrefix(typeName, base+versionSeparator))
+	return strings.HasPrefix(typeName, base+versionSeparator) && err == nil
+}
+
+// Verifies that the TypeTypename of persisted state names this type,
+// at the same version as the value's header.
+func (v *VersionedType) checkTypeName(typeName string, version int) error {
+	if typeName == "" {
+		return nil
+	}
+
+	base := v.inner.GetTypeName().String()
+	if typeName == base {
+		return nil
+	}
+
+	if !strings.HasPrefix(typeName, base+versionSeparator) {
+		return fmt.Errorf("state of type %s cannot be read as %s", typeName, v.typeName)
+	}
+
+	named, err := strconv.Atoi(strings.TrimPrefix(typeName, base+versionSeparator))
+	if err != nil {
+		return fmt.Errorf("state of type %s cannot be read as %s", typeName, v.typeName)
+	}
+
+	if named != version {
+		return fmt.Errorf("state of type %s has a value written with version %d", typeName, version)
+	}
+
+	return nil
+}
+
+// Applies migrations to upgrade the payload from the given version.
+func (v *VersionedType) migrate(version int, payload []byte) ([]byte, error) {
+	if version > v.version {
+		return nil, fmt.Errorf("value was written with version %d, which is newer than %s", version, v.typeName)
+	}
+
+	for ; version < v.version; version++ {
+		migration, exists := v.migrations[version]
+		if !exists {
+			return nil, fmt.Errorf("missing migration from version %d of %s", version, v.typeName)
+		}
+
+		var err error
+		if payload, err = migration(payload); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s from version %d: %w", v.typeName, version, err)
+		}
+	}
+
+	return payload, nil
+}
+
+func versionHeader(version int) []byte {
+	return binary.AppendUvarint(append([]byte(nil), versionMarker[:]...), uint64(version))
+}
+
+// Splits a value into its version and payload. Values
+// without a version header are treated as version 0.
+func readVersion(data []byte) (int, []byte, error) {
+	if len(data) < len(versionMarker) || data[0] != versionMarker[0] || data[1] != versionMarker[1] {
+		return 0, data, nil
+	}
+
+	version, n := binary.Uvarint(data[len(versionMarker):])
+	if n <= 0 {
+		return 0, nil, errors.New("malformed version header")
+	}
+
+	return int(version), data[len(versionMarker)+n:], nil
+}
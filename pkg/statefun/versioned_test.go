@@ -0,0 +1,127 @@
+package statefun
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type userV2 struct {
+	Name   string `json:"name"`
+	Visits int    `json:"visits"`
+}
+
+func splitName(data []byte) ([]byte, error) {
+	var user User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]string{"name": user.FirstName + " " + user.LastName})
+}
+
+func addVisits(data []byte) ([]byte, error) {
+	var user map[string]interface{}
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+
+	user["visits"] = 1
+	return json.Marshal(user)
+}
+
+func versionedUserType() *VersionedType {
+	return MakeVersionedType(MakeJsonType(TypeNameFrom("org.foo/User")), 2).
+		WithMigration(0, splitName).
+		WithMigration(1, addVisits)
+}
+
+func TestVersionedType(t *testing.T) {
+	userType := versionedUserType()
+	assert.Equal(t, "org.foo/User@v2", userType.GetTypeName().String())
+
+	buffer := bytes.Buffer{}
+	err := userType.Serialize(&buffer, userV2{Name: "bob mop", Visits: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xFE, 0x56, 0x02}, buffer.Bytes()[:3])
+
+	var user userV2
+	err = userType.Deserialize(bytes.NewReader(buffer.Bytes()), &user)
+	assert.NoError(t, err)
+	assert.Equal(t, userV2{Name: "bob mop", Visits: 3}, user)
+
+	legacy, _ := json.Marshal(User{"bob", "mop"})
+	err = userType.Deserialize(bytes.NewReader(legacy), &user)
+	assert.NoError(t, err)
+	assert.Equal(t, userV2{Name: "bob mop", Visits: 1}, user, "values without a header should be migrated from version 0")
+
+	newer := bytes.Buffer{}
+	_ = MakeVersionedType(MakeJsonType(TypeNameFrom("org.foo/User")), 3).Serialize(&newer, user)
+	err = userType.Deserialize(&newer, &user)
+	assert.Error(t, err, "values written with a newer version cannot be read")
+
+	missing := MakeVersionedType(MakeJsonType(TypeNameFrom("org.foo/User")), 2).WithMigration(1, addVisits)
+	err = missing.Deserialize(bytes.NewReader(legacy), &user)
+	assert.Error(t, err, "every version requires a migration")
+}
+
+func versionedStorage(t *testing.T, spec ValueSpec, typeName string, value []byte) *storage {
+	storage, err := storageWithValue(spec, typeName, value)
+	assert.NoError(t, err)
+	return storage
+}
+
+func TestVersionedStateUpgrade(t *testing.T) {
+	spec := ValueSpec{Name: "user", ValueType: versionedUserType()}
+
+	legacy, _ := json.Marshal(User{"bob", "mop"})
+	storage := versionedStorage(t, spec, "org.foo/User", legacy)
+
+	var user userV2
+	assert.True(t, storage.Get(spec, &user))
+	assert.Equal(t, userV2{Name: "bob mop", Visits: 1}, user)
+
+	mutations := storage.getStateMutations()
+	assert.Len(t, mutations, 1, "upgraded state should be written back")
+	assert.Equal(t, "org.foo/User@v2", mutations[0].StateValue.Typename)
+
+	var written userV2
+	err := spec.ValueType.Deserialize(bytes.NewReader(mutations[0].StateValue.Value), &written)
+	assert.NoError(t, err)
+	assert.Equal(t, user, written)
+
+	// reading current state does not write it back
+	current := versionedStorage(t, spec, "org.foo/User@v2", mutations[0].StateValue.Value)
+	assert.True(t, current.Get(spec, &user))
+	assert.Empty(t, current.getStateMutations())
+}
+
+func TestVersionedStateTypeNameMismatch(t *testing.T) {
+	spec := ValueSpec{Name: "user", ValueType: versionedUserType()}
+
+	legacy, _ := json.Marshal(User{"bob", "mop"})
+
+	_, err := storageWithValue(spec, "org.foo/Customer", legacy)
+	assert.Error(t, err, "state of a different type cannot be read")
+
+	var user userV2
+	inconsistent := versionedStorage(t, spec, "org.foo/User@v1", legacy)
+	assert.Panics(t, func() { inconsistent.Get(spec, &user) }, "the typename version must match the value's header")
+}
+
+func TestVersionedStateRollback(t *testing.T) {
+	spec := ValueSpec{Name: "user", ValueType: versionedUserType()}
+
+	legacy, _ := json.Marshal(User{"bob", "mop"})
+	storage := versionedStorage(t, spec, "org.foo/User", legacy)
+
+	storage.checkpoint()
+	var user userV2
+	assert.True(t, storage.Get(spec, &user))
+	storage.rollback()
+
+	assert.Empty(t, storage.getStateMutations())
+	assert.True(t, storage.Get(spec, &user), "rolled back state should be upgraded again")
+	assert.Equal(t, userV2{Name: "bob mop", Visits: 1}, user)
+}
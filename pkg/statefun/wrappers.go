@@ -0,0 +1,408 @@
+package statefun
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"time"
+)
+
+// Primitive values are encoded as the protobuf wrapper messages
+// shared by all StateFun SDKs, for example:
+//
+//	package io.statefun.sdk.types;
+//
+//	message IntWrapper {
+//	  sfixed32 value = 1;
+//	}
+//
+//	message LongWrapper {
+//	  sfixed64 value = 1;
+//	}
+//
+// The types that are specific to the Go SDK follow the equivalent
+// google.protobuf well-known types. As in proto3, fields holding
+// the zero value are omitted, so zero values are encoded as an
+// empty payload.
+const (
+	wrapperValue protowire.Number = 1
+
+	secondsField protowire.Number = 1
+	nanosField   protowire.Number = 2
+)
+
+// Returns the length of a value in the raw encoding of earlier versions
+// of the Go SDK, for the primitives whose wrapper message never has that
+// length, or 0 if raw values cannot be told apart from wrapper messages.
+func (p PrimitiveType) rawWidth() int {
+	switch p {
+	case BoolType:
+		return 1
+	case Int32Type, Float32Type:
+		return 4
+	case Int64Type, Float64Type:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Encodes data as the protobuf wrapper message of the primitive.
+func (p PrimitiveType) wrap(data interface{}) ([]byte, error) {
+	switch p {
+	case BoolType:
+		switch data := data.(type) {
+		case bool:
+			return appendVarintField(nil, wrapperValue, protowire.EncodeBool(data)), nil
+		case *bool:
+			return appendVarintField(nil, wrapperValue, protowire.EncodeBool(*data)), nil
+		default:
+			return nil, errors.New("data must be of type bool or *bool")
+		}
+	case Int32Type:
+		switch data := data.(type) {
+		case int32:
+			return appendFixed32Field(nil, wrapperValue, uint32(data)), nil
+		case *int32:
+			return appendFixed32Field(nil, wrapperValue, uint32(*data)), nil
+		default:
+			return nil, errors.New("data must be of type int32 or *int32")
+		}
+	case Int64Type:
+		switch data := data.(type) {
+		case int64:
+			return appendFixed64Field(nil, wrapperValue, uint64(data)), nil
+		case *int64:
+			return appendFixed64Field(nil, wrapperValue, uint64(*data)), nil
+		default:
+			return nil, errors.New("data must be of type int64 or *int64")
+		}
+	case Float32Type:
+		switch data := data.(type) {
+		case float32:
+			return appendFixed32Field(nil, wrapperValue, math.Float32bits(data)), nil
+		case *float32:
+			return appendFixed32Field(nil, wrapperValue, math.Float32bits(*data)), nil
+		default:
+			return nil, errors.New("data must be of type float32 or *float32")
+		}
+	case Float64Type:
+		switch data := data.(type) {
+		case float64:
+			return appendFixed64Field(nil, wrapperValue, math.Float64bits(data)), nil
+		case *float64:
+			return appendFixed64Field(nil, wrapperValue, math.Float64bits(*data)), nil
+		default:
+			return nil, errors.New("data must be of type float64 or *float64")
+		}
+	case StringType:
+		switch data := data.(type) {
+		case string:
+			return appendBytesField(nil, wrapperValue, []byte(data)), nil
+		case *string:
+			return appendBytesField(nil, wrapperValue, []byte(*data)), nil
+		default:
+			return nil, errors.New("data must be of type string or *string")
+		}
+	case BytesType:
+		switch data := data.(type) {
+		case []byte:
+			return appendBytesField(nil, wrapperValue, data), nil
+		case *[]byte:
+			return appendBytesField(nil, wrapperValue, *data), nil
+		default:
+			return nil, errors.New("data must be of type []byte or *[]byte")
+		}
+	case Uint32Type:
+		switch data := data.(type) {
+		case uint32:
+			return appendVarintField(nil, wrapperValue, uint64(data)), nil
+		case *uint32:
+			return appendVarintField(nil, wrapperValue, uint64(*data)), nil
+		default:
+			return nil, errors.New("data must be of type uint32 or *uint32")
+		}
+	case Uint64Type:
+		switch data := data.(type) {
+		case uint64:
+			return appendVarintField(nil, wrapperValue, data), nil
+		case *uint64:
+			return appendVarintField(nil, wrapperValue, *data), nil
+		default:
+			return nil, errors.New("data must be of type uint64 or *uint64")
+		}
+	case TimeType:
+		switch data := data.(type) {
+		case time.Time:
+			return appendSecondsAndNanos(nil, data.Unix(), int32(data.Nanosecond())), nil
+		case *time.Time:
+			return appendSecondsAndNanos(nil, data.Unix(), int32(data.Nanosecond())), nil
+		default:
+			return nil, errors.New("data must be of type time.Time or *time.Time")
+		}
+	case DurationType:
+		switch data := data.(type) {
+		case time.Duration:
+			return appendSecondsAndNanos(nil, int64(data/time.Second), int32(data%time.Second)), nil
+		case *time.Duration:
+			return appendSecondsAndNanos(nil, int64(*data/time.Second), int32(*data%time.Second)), nil
+		default:
+			return nil, errors.New("data must be of type time.Duration or *time.Duration")
+		}
+	default:
+		panic(fmt.Errorf("unknown primitive type %d", int(p)))
+	}
+}
+
+// Decodes the protobuf wrapper message of the primitive into receiver.
+func (p PrimitiveType) unwrap(data []byte, receiver interface{}) error {
+	switch p {
+	case BoolType:
+		switch receiver := receiver.(type) {
+		case *bool:
+			value, err := consumeVarintField(data, wrapperValue)
+			*receiver = protowire.DecodeBool(value)
+			return err
+		default:
+			return errors.New("receiver must be of type bool or *bool")
+		}
+	case Int32Type:
+		switch receiver := receiver.(type) {
+		case *int32:
+			value, err := consumeFixedField(data, wrapperValue, protowire.Fixed32Type)
+			*receiver = int32(value)
+			return err
+		default:
+			return errors.New("receiver must be of type *int32")
+		}
+	case Int64Type:
+		switch receiver := receiver.(type) {
+		case *int64:
+			value, err := consumeFixedField(data, wrapperValue, protowire.Fixed64Type)
+			*receiver = int64(value)
+			return err
+		default:
+			return errors.New("receiver must be of type *int64")
+		}
+	case Float32Type:
+		switch receiver := receiver.(type) {
+		case *float32:
+			value, err := consumeFixedField(data, wrapperValue, protowire.Fixed32Type)
+			*receiver = math.Float32frombits(uint32(value))
+			return err
+		default:
+			return errors.New("receiver must be of type *float32")
+		}
+	case Float64Type:
+		switch receiver := receiver.(type) {
+		case *float64:
+			value, err := consumeFixedField(data, wrapperValue, protowire.Fixed64Type)
+			*receiver = math.Float64frombits(value)
+			return err
+		default:
+			return errors.New("receiver must be of type *float64")
+		}
+	case StringType:
+		switch receiver := receiver.(type) {
+		case *string:
+			value, err := consumeBytesField(data, wrapperValue)
+			*receiver = string(value)
+			return err
+		default:
+			return errors.New("receiver must be of type *string")
+		}
+	case BytesType:
+		switch receiver := receiver.(type) {
+		case *[]byte:
+			value, err := consumeBytesField(data, wrapperValue)
+			*receiver = value
+			return err
+		default:
+			return errors.New("receiver must be of type *[]byte")
+		}
+	case Uint32Type:
+		switch receiver := receiver.(type) {
+		case *uint32:
+			value, err := consumeVarintField(data, wrapperValue)
+			*receiver = uint32(value)
+			return err
+		default:
+			return errors.New("receiver must be of type *uint32")
+		}
+	case Uint64Type:
+		switch receiver := receiver.(type) {
+		case *uint64:
+			value, err := consumeVarintField(data, wrapperValue)
+			*receiver = value
+			return err
+		default:
+			return errors.New("receiver must be of type *uint64")
+		}
+	case TimeType:
+		switch receiver := receiver.(type) {
+		case *time.Time:
+			seconds, nanos, err := consumeSecondsAndNanos(data)
+			*receiver = time.Unix(seconds, int64(nanos)).UTC()
+			return err
+		default:
+			return errors.New("receiver must be of type *time.Time")
+		}
+	case DurationType:
+		switch receiver := receiver.(type) {
+		case *time.Duration:
+			seconds, nanos, err := consumeSecondsAndNanos(data)
+			*receiver = time.Duration(seconds)*time.Second + time.Duration(nanos)
+			return err
+		default:
+			return errors.New("receiver must be of type *time.Duration")
+		}
+	default:
+		panic(fmt.Errorf("unknown primitive type %d", int(p)))
+	}
+}
+
+func appendVarintField(b []byte, number protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func appendFixed32Field(b []byte, number protowire.Number, value uint32) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, number, protowire.Fixed32Type)
+	return protowire.AppendFixed32(b, value)
+}
+
+func appendFixed64Field(b []byte, number protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, number, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, value)
+}
+
+func appendBytesField(b []byte, number protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+func appendSecondsAndNanos(b []byte, seconds int64, nanos int32) []byte {
+	b = appendVarintField(b, secondsField, uint64(seconds))
+	return appendVarintField(b, nanosField, uint64(nanos))
+}
+
+// Returns the last occurrence of the varint field, or zero if it is
+// missing, skipping all other fields as required by protobuf.
+func consumeVarintField(data []byte, number protowire.Number) (uint64, error) {
+	var result uint64
+	err := consumeFields(data, func(n protowire.Number, wireType protowire.Type, field []byte) (int, error) {
+		if n != number {
+			return protowire.ConsumeFieldValue(n, wireType, field), nil
+		}
+
+		if wireType != protowire.VarintType {
+			return 0, fmt.Errorf("field %d has wire type %d, expected varint", n, wireType)
+		}
+
+		value, length := protowire.ConsumeVarint(field)
+		result = value
+		return length, nil
+	})
+
+	return result, err
+}
+
+// Returns the last occurrence of the fixed32 or fixed64 field,
+// or zero if it is missing.
+func consumeFixedField(data []byte, number protowire.Number, expected protowire.Type) (uint64, error) {
+	var result uint64
+	err := consumeFields(data, func(n protowire.Number, wireType protowire.Type, field []byte) (int, error) {
+		if n != number {
+			return protowire.ConsumeFieldValue(n, wireType, field), nil
+		}
+
+		if wireType != expected {
+			return 0, fmt.Errorf("field %d has wire type %d, expected %d", n, wireType, expected)
+		}
+
+		if expected == protowire.Fixed32Type {
+			value, length := protowire.ConsumeFixed32(field)
+			result = uint64(value)
+			return length, nil
+		}
+
+		value, length := protowire.ConsumeFixed64(field)
+		result = value
+		return length, nil
+	})
+
+	return result, err
+}
+
+// Returns the last occurrence of the length-delimited
+// field, or nil if it is missing.
+func consumeBytesField(data []byte, number protowire.Number) ([]byte, error) {
+	var result []byte
+	err := consumeFields(data, func(n protowire.Number, wireType protowire.Type, field []byte) (int, error) {
+		if n != number {
+			return protowire.ConsumeFieldValue(n, wireType, field), nil
+		}
+
+		if wireType != protowire.BytesType {
+			return 0, fmt.Errorf("field %d has wire type %d, expected bytes", n, wireType)
+		}
+
+		value, length := protowire.ConsumeBytes(field)
+		result = value
+		return length, nil
+	})
+
+	return result, err
+}
+
+func consumeSecondsAndNanos(data []byte) (int64, int32, error) {
+	seconds, err := consumeVarintField(data, secondsField)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	nanos, err := consumeVarintField(data, nanosField)
+	return int64(seconds), int32(nanos), err
+}
+
+// Calls fn with the number, wire type and remaining data of every
+// field in the message. The function returns the length of the field
+// value it consumed, or a negative protowire error code.
+func consumeFields(data []byte, fn func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		n, err := fn(number, wireType, data)
+		if err != nil {
+			return err
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package statefun
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Golden vectors for the encoding of every primitive type. The
+// vectors of the types shared with the Java and Python SDKs were
+// produced by the Go protobuf runtime from the wrapper messages
+// declared in io/statefun/sdk/types/types.proto, built with
+// dynamicpb; they were not captured from the Java or Python SDKs.
+// Those of the types specific to the Go SDK were produced from the
+// google.protobuf well-known types (BytesValue, UInt32Value,
+// UInt64Value, Timestamp and Duration).
+var primitiveVectors = []struct {
+	primitive PrimitiveType
+	value     interface{}
+	encoded   string
+}{
+	{BoolType, true, "0801"},
+	{BoolType, false, ""},
+	{Int32Type, int32(1), "0d01000000"},
+	{Int32Type, int32(-1), "0dffffffff"},
+	{Int32Type, int32(2147483647), "0dffffff7f"},
+	{Int32Type, int32(-2147483648), "0d00000080"},
+	{Int32Type, int32(0), ""},
+	{Int64Type, int64(1 << 45), "090000000000200000"},
+	{Int64Type, int64(-2), "09feffffffffffffff"},
+	{Int64Type, int64(0), ""},
+	{Float32Type, float32(0.5), "0d0000003f"},
+	{Float32Type, float32(-1.25), "0d0000a0bf"},
+	{Float32Type, float32(0), ""},
+	{Float64Type, 1e-20, "092342920ca19cc73b"},
+	{Float64Type, 3.14159, "096e861bf0f9210940"},
+	{Float64Type, float64(0), ""},
+	{StringType, "hello world", "0a0b68656c6c6f20776f726c64"},
+	{StringType, "héllo", "0a0668c3a96c6c6f"},
+	{StringType, "", ""},
+	{BytesType, []byte{0x00, 0x01, 0xFF}, "0a030001ff"},
+	{Uint32Type, uint32(4294967295), "08ffffffff0f"},
+	{Uint32Type, uint32(0), ""},
+	{Uint64Type, uint64(1 << 63), "0880808080808080808001"},
+	{TimeType, time.Unix(1700000000, 123456789).UTC(), "0880e2cfaa0610959aef3a"},
+	{TimeType, time.Unix(-1, 0).UTC(), "08ffffffffffffffffff01"},
+	{TimeType, time.Unix(0, 0).UTC(), ""},
+	{DurationType, 90 * time.Minute, "08982a"},
+	{DurationType, -1500 * time.Millisecond, "08ffffffffffffffffff011080b6ca91feffffffff01"},
+	{DurationType, time.Duration(0), ""},
+}
+
+func TestPrimitiveGoldenVectors(t *testing.T) {
+	for _, vector := range primitiveVectors {
+		name := vector.primitive.GetTypeName().String()
+		expected, _ := hex.DecodeString(vector.encoded)
+
+		buffer := bytes.Buffer{}
+		err := vector.primitive.Serialize(&buffer, vector.value)
+		assert.NoError(t, err, name)
+		assert.Equal(t, vector.encoded, hex.EncodeToString(buffer.Bytes()), "%s should encode %v", name, vector.value)
+
+		receiver := reflect.New(reflect.TypeOf(vector.value))
+		err = vector.primitive.Deserialize(bytes.NewReader(expected), receiver.Interface())
+		assert.NoError(t, err, name)
+
+		if value, ok := vector.value.([]byte); ok {
+			assert.Equal(t, value, receiver.Elem().Bytes(), name)
+		} else {
+			assert.Equal(t, vector.value, receiver.Elem().Interface(), "%s should decode %s", name, vector.encoded)
+		}
+	}
+}
+
+func TestPrimitiveSkipsUnknownFields(t *testing.T) {
+	// field 2 (varint 5) followed by the value field 1
+	data, _ := hex.DecodeString("10050d01000000")
+
+	var result int32
+	err := Int32Type.Deserialize(bytes.NewReader(data), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), result)
+
+	// the value field encoded as a varint instead of sfixed32
+	err = Int32Type.Deserialize(bytes.NewReader([]byte{0x08, 0x01}), &result)
+	assert.Error(t, err, "a value field with the wrong wire type should fail")
+}
+
+func TestRawPrimitiveEncoding(t *testing.T) {
+	raw := Int32Type.WithRawEncoding()
+	assert.Equal(t, Int32Type.GetTypeName(), raw.GetTypeName())
+
+	buffer := bytes.Buffer{}
+	err := raw.Serialize(&buffer, int32(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x01}, buffer.Bytes())
+
+	var result int32
+	err = raw.Deserialize(bytes.NewReader(buffer.Bytes()), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), result)
+
+	buffer.Reset()
+	err = StringType.WithRawEncoding().Serialize(&buffer, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", buffer.String())
+}
+
+func TestPrimitiveReadsRawEncoding(t *testing.T) {
+	values := []struct {
+		primitive PrimitiveType
+		value     interface{}
+	}{
+		{BoolType, true},
+		{Int32Type, int32(-7)},
+		{Int64Type, int64(1 << 40)},
+		{Float32Type, float32(0.5)},
+		{Float64Type, 3.14159},
+	}
+
+	for _, value := range values {
+		name := value.primitive.GetTypeName().String()
+
+		buffer := bytes.Buffer{}
+		err := value.primitive.WithRawEncoding().Serialize(&buffer, value.value)
+		assert.NoError(t, err, name)
+
+		receiver := reflect.New(reflect.TypeOf(value.value))
+		err = value.primitive.Deserialize(&buffer, receiver.Interface())
+		assert.NoError(t, err, name)
+		assert.Equal(t, value.value, receiver.Elem().Interface(), "%s should read raw values", name)
+	}
+}